@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// adminAuth guards the admin API with a bearer token. With no token
+// configured the admin API is disabled.
+func adminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeError(w, http.StatusForbidden, errors.New("Admin API is disabled, set ADMIN_TOKEN to enable it"))
+				return
+			}
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeError(w, http.StatusUnauthorized, errors.New("Invalid or missing admin token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isAdmin reports whether r is for the admin API, which fault injection
+// leaves alone.
+func isAdmin(r *http.Request) bool {
+	return r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/")
+}
+
+// resetPrefixes are the state store keys POST /admin/reset clears besides
+// the stubs: cycle, sequence and scenario progress, bins, stub scenario
+// states, async jobs, /conditional resources and sessions. Idempotency keys
+// and the /store sandbox are kept.
+var resetPrefixes = []string{"cycle:", "sequence:", "scenario:", "scenario-state:", "bin:", "job:", "version:", "session:"}
+
+// StateResetHandler clears the state of the stateful endpoints between test
+// runs. Within a session, only that session's state is cleared.
+func StateResetHandler(store Store, s *stubs, ss *sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		if current := requestSession(r); current != nil {
+			if _, err := ss.reset(current); err != nil {
+				stateError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := s.update(func([]*stub) []*stub { return nil }); err != nil {
+			stateError(w, err)
+			return
+		}
+		for _, prefix := range resetPrefixes {
+			if _, err := store.DeletePrefix(prefix); err != nil {
+				stateError(w, err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// requestInfo describes a request as echoed back by /anything.
+type requestInfo struct {
+	Method       string                 `json:"method"`
+	URL          string                 `json:"url"`
+	Path         string                 `json:"path"`
+	Args         map[string]interface{} `json:"args"`
+	Headers      map[string]string      `json:"headers"`
+	Cookies      map[string]string      `json:"cookies"`
+	Origin       string                 `json:"origin"`
+	Body         string                 `json:"body"`
+	BodyEncoding string                 `json:"body_encoding,omitempty"`
+	JSON         interface{}            `json:"json"`
+	Form         map[string]interface{} `json:"form"`
+	Files        map[string]interface{} `json:"files"`
+}
+
+// flatten turns single-valued entries into plain strings, as httpbin does.
+func flatten(values map[string][]string) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for name, v := range values {
+		if len(v) == 1 {
+			flat[name] = v[0]
+		} else {
+			flat[name] = v
+		}
+	}
+	return flat
+}
+
+// requestURL reconstructs the absolute URL the client asked for.
+func requestURL(r *http.Request) string {
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// describeRequest reads the request body, up to maxBodySize, and describes
+// the request. Form and multipart bodies are decoded, as are JSON ones.
+func describeRequest(r *http.Request) (requestInfo, error) {
+	info := requestInfo{
+		Method:  r.Method,
+		URL:     requestURL(r),
+		Path:    r.URL.Path,
+		Args:    flatten(r.URL.Query()),
+		Headers: map[string]string{},
+		Cookies: map[string]string{},
+		Form:    map[string]interface{}{},
+		Files:   map[string]interface{}{},
+	}
+	for name, values := range r.Header {
+		info.Headers[name] = strings.Join(values, ", ")
+	}
+	if r.Host != "" {
+		info.Headers["Host"] = r.Host
+	}
+	for _, c := range r.Cookies() {
+		info.Cookies[c.Name] = c.Value
+	}
+	info.Origin = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		info.Origin = host
+	}
+
+	if r.Body == nil {
+		return info, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return info, errors.Wrap(err, "Unable to read body")
+	}
+	if len(body) > maxBodySize {
+		return info, errors.Errorf("Body must not exceed %d bytes", maxBodySize)
+	}
+	if utf8.Valid(body) {
+		info.Body = string(body)
+	} else {
+		info.Body, info.BodyEncoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+
+	info.JSON, info.Form, info.Files = decodeBody(body, r.Header.Get("Content-Type"))
+	return info, nil
+}
+
+// decodeBody decodes a JSON, URL-encoded form or multipart form body
+// according to its content type. Bodies that fail to decode are left out.
+func decodeBody(body []byte, contentType string) (doc interface{}, form, files map[string]interface{}) {
+	form, files = map[string]interface{}{}, map[string]interface{}{}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		json.Unmarshal(body, &doc)
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			form = flatten(values)
+		}
+	case mediaType == "multipart/form-data":
+		mf, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(maxBodySize)
+		if err != nil {
+			break
+		}
+		defer mf.RemoveAll()
+		form = flatten(mf.Value)
+		for name, list := range mf.File {
+			var parts []map[string]interface{}
+			for _, f := range list {
+				parts = append(parts, map[string]interface{}{"filename": f.Filename, "size": f.Size, "content_type": f.Header.Get("Content-Type")})
+			}
+			if len(parts) == 1 {
+				files[name] = parts[0]
+			} else {
+				files[name] = parts
+			}
+		}
+	}
+	return doc, form, files
+}
+
+// AnythingHandler echoes the request back as JSON, for any method and any
+// path below /anything. The code query parameter sets the status.
+func AnythingHandler(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+	if v := r.URL.Query().Get("code"); v != "" {
+		var err error
+		if code, err = checkCode(r, v); err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+
+	info, err := describeRequest(r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(info)
+}
+
+// MethodHandler echoes requests like /anything, but only for the given
+// methods, answering others with 405. GET also allows HEAD.
+func MethodHandler(methods ...string) http.HandlerFunc {
+	for _, m := range methods {
+		if m == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+			break
+		}
+	}
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				AnythingHandler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// maxPolls caps the poll-after query parameter.
+const maxPolls = 1000
+
+type job struct {
+	Code    int `json:"code"`
+	Pending int `json:"pending"`
+}
+
+// jobs tracks simulated async jobs in the state store until they expire, so
+// that any replica can answer a poll. A job lives at job:{id} and the count
+// of its polls at job:{id}:polls.
+type jobs struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newJobs(store Store, ttl time.Duration) *jobs {
+	return &jobs{store: store, ttl: ttl}
+}
+
+func (j *jobs) add(code, pending int) (string, error) {
+	id := newUUID()
+	v, _ := json.Marshal(job{Code: code, Pending: pending})
+	return id, j.store.Set("job:"+id, v, j.ttl)
+}
+
+// poll records a poll of job id and returns how many further polls will
+// still see it pending, or -1 once it is done.
+func (j *jobs) poll(id string) (job, int, bool, error) {
+	var jb job
+	v, ok, err := j.store.Get("job:" + id)
+	if err != nil || !ok {
+		return jb, 0, false, err
+	}
+	if err := json.Unmarshal(v, &jb); err != nil {
+		return jb, 0, false, errors.Wrapf(err, "Unable to process job %q", id)
+	}
+	n, err := j.store.Incr("job:"+id+":polls", j.ttl)
+	if err != nil {
+		return jb, 0, false, err
+	}
+	if int(n) > jb.Pending {
+		return jb, -1, true, nil
+	}
+	return jb, jb.Pending - int(n), true, nil
+}
+
+// AsyncHandler starts a simulated job that finishes with the code after the
+// status resource it points Location at has been polled poll-after times.
+func AsyncHandler(j *jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, err := parseCode(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		polls := 3
+		if v := r.URL.Query().Get("poll-after"); v != "" {
+			if polls, err = strconv.Atoi(v); err != nil || polls < 0 || polls > maxPolls {
+				badRequest(w, errors.Errorf("Invalid poll-after %q, expected 0 to %d", v, maxPolls))
+				return
+			}
+		}
+
+		id, err := j.add(code, polls)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		location := "/async/jobs/" + id
+		if v := r.URL.Query().Get("strict"); v != "" {
+			location += "?" + url.Values{"strict": {v}}.Encode()
+		}
+		w.Header().Set("Location", location)
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "status": "pending", "location": location})
+	}
+}
+
+// AsyncJobHandler reports a job as pending until it has been polled enough
+// times, then responds with its final code on every poll after.
+func AsyncJobHandler(j *jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		jb, remaining, ok, err := j.poll(id)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.Errorf("Job %q does not exist", id))
+			return
+		}
+		if remaining < 0 {
+			StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(jb.Code)}))
+			return
+		}
+
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "status": "pending", "polls_remaining": remaining})
+	}
+}
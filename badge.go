@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+)
+
+// badgeCharWidth approximates the advance of an 11px Verdana glyph, which is
+// close enough to size badge segments without font metrics.
+const badgeCharWidth = 7
+
+const badgeSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">` +
+	`<title>%[3]s: %[4]s</title>` +
+	`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[5]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%[7]d" y="14">%[3]s</text><text x="%[8]d" y="14">%[4]s</text></g></svg>`
+
+// BadgeHandler renders a shields.io style SVG badge for the status code.
+func BadgeHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = "status"
+	}
+	message := strconv.Itoa(code)
+	if reason := http.StatusText(code); reason != "" {
+		message += " " + reason
+	}
+
+	labelWidth := len(label)*badgeCharWidth + 10
+	messageWidth := len(message)*badgeCharWidth + 10
+	c := statusColor(code)
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+	fmt.Fprintf(w, badgeSVG,
+		labelWidth+messageWidth, labelWidth,
+		html.EscapeString(label), html.EscapeString(message),
+		messageWidth, fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B),
+		labelWidth/2, labelWidth+messageWidth/2)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// Base64Handler decodes the URL-safe base64 path segment and responds with
+// it. Padding is optional.
+func Base64Handler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	body, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(vars["value"], "="))
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to decode value"))
+		return
+	}
+
+	v := r.URL.Query().Get("code")
+	if v == "" {
+		v = strconv.Itoa(http.StatusOK)
+	}
+	code, err := checkCode(r, v)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(body))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+	w.Write(body)
+}
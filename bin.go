@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// maxBinRequests caps how many captured requests each bin keeps, dropping
+// the oldest first.
+const maxBinRequests = 100
+
+type capturedRequest struct {
+	Time time.Time `json:"time"`
+	requestInfo
+}
+
+type bin struct {
+	Token    string            `json:"token"`
+	Created  time.Time         `json:"created"`
+	Expires  time.Time         `json:"expires"`
+	Requests []capturedRequest `json:"requests"`
+}
+
+// bins keeps requestbin-style capture bins in the state store until they
+// expire. A bin's metadata lives at bin:{token}, its request count at
+// bin:{token}:count and each request at bin:{token}:{n}.
+type bins struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newBins(store Store, ttl time.Duration) *bins {
+	return &bins{store: store, ttl: ttl}
+}
+
+func (b *bins) create() (bin, error) {
+	now := time.Now().UTC()
+	bn := bin{Token: newUUID(), Created: now, Expires: now.Add(b.ttl), Requests: []capturedRequest{}}
+	meta, _ := json.Marshal(bn)
+	return bn, b.store.Set("bin:"+bn.Token, meta, b.ttl)
+}
+
+// meta returns the live bin for token, without its requests.
+func (b *bins) meta(token string) (bin, bool, error) {
+	var bn bin
+	v, ok, err := b.store.Get("bin:" + token)
+	if err != nil || !ok {
+		return bn, false, err
+	}
+	if err := json.Unmarshal(v, &bn); err != nil {
+		return bn, false, err
+	}
+	return bn, true, nil
+}
+
+func (b *bins) capture(token string, info requestInfo) (int64, bool, error) {
+	bn, ok, err := b.meta(token)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	ttl := time.Until(bn.Expires)
+	if ttl <= 0 {
+		return 0, false, nil
+	}
+	prefix := "bin:" + token + ":"
+	n, err := b.store.Incr(prefix+"count", ttl)
+	if err != nil {
+		return 0, false, err
+	}
+	v, _ := json.Marshal(capturedRequest{Time: time.Now().UTC(), requestInfo: info})
+	if err := b.store.Set(prefix+strconv.FormatInt(n, 10), v, ttl); err != nil {
+		return 0, false, err
+	}
+	if n > maxBinRequests {
+		if _, err := b.store.Delete(prefix + strconv.FormatInt(n-maxBinRequests, 10)); err != nil {
+			return 0, false, err
+		}
+		n = maxBinRequests
+	}
+	return n, true, nil
+}
+
+func (b *bins) get(token string) (bin, bool, error) {
+	bn, ok, err := b.meta(token)
+	if err != nil || !ok {
+		return bn, false, err
+	}
+	prefix := "bin:" + token + ":"
+	v, ok, err := b.store.Get(prefix + "count")
+	if err != nil {
+		return bn, false, err
+	}
+	var count int64
+	if ok {
+		count, _ = strconv.ParseInt(string(v), 10, 64)
+	}
+	first := count - maxBinRequests + 1
+	if first < 1 {
+		first = 1
+	}
+	for n := first; n <= count; n++ {
+		v, ok, err := b.store.Get(prefix + strconv.FormatInt(n, 10))
+		if err != nil {
+			return bn, false, err
+		}
+		var req capturedRequest
+		if ok && json.Unmarshal(v, &req) == nil {
+			bn.Requests = append(bn.Requests, req)
+		}
+	}
+	return bn, true, nil
+}
+
+// NewBinHandler creates a bin that captures whatever is sent to it until it
+// expires.
+func NewBinHandler(b *bins) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		bn, err := b.create()
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/bin/"+bn.Token)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"token":        bn.Token,
+			"url":          "/bin/" + bn.Token,
+			"requests_url": "/bin/" + bn.Token + "/requests",
+			"expires":      bn.Expires,
+		})
+	}
+}
+
+// BinHandler captures any request sent to a bin. The code query parameter
+// sets the status.
+func BinHandler(b *bins) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := mux.Vars(r)["token"]
+		code := http.StatusOK
+		if v := r.URL.Query().Get("code"); v != "" {
+			var err error
+			if code, err = checkCode(r, v); err != nil {
+				badRequest(w, err)
+				return
+			}
+		}
+
+		info, err := describeRequest(r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		n, ok, err := b.capture(token, info)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.Errorf("Bin %q does not exist or has expired", token))
+			return
+		}
+		writeJSON(w, code, map[string]interface{}{"token": token, "captured": n})
+	}
+}
+
+// BinRequestsHandler lists the requests captured by a bin, oldest first.
+func BinRequestsHandler(b *bins) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		token := mux.Vars(r)["token"]
+		bn, ok, err := b.get(token)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.Errorf("Bin %q does not exist or has expired", token))
+			return
+		}
+		writeJSON(w, http.StatusOK, bn)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("hang")
+}
+
+// blackhole hijacks the connection and never answers. It lifts the server's
+// deadlines and waits until the client hangs up or d has passed, then closes
+// the connection.
+func blackhole(w http.ResponseWriter, d time.Duration) error {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("response does not support hijacking")
+	}
+	conn, buf, err := h.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Time{})
+	conn.SetReadDeadline(time.Now().Add(d))
+	io.Copy(io.Discard, buf)
+	return nil
+}
+
+// hangParam parses the hang query parameter, either a boolean or how long to
+// hang for. It returns 0 when the request should not hang.
+func hangParam(r *http.Request, max time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get("hang")
+	if v == "" {
+		return 0, nil
+	}
+	if hang, err := strconv.ParseBool(v); err == nil {
+		if hang {
+			return max, nil
+		}
+		return 0, nil
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d > max {
+		return 0, errors.Errorf("must not exceed %s", max)
+	}
+	return d, nil
+}
+
+// BlackholeHandler accepts requests and never responds, until the client
+// gives up or the hang query parameter (at most max) runs out.
+func BlackholeHandler(max time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := hangParam(r, max)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process hang"))
+			return
+		}
+		if d == 0 {
+			d = max
+		}
+		if err := blackhole(w, d); err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hang connection"))
+		}
+	}
+}
+
+// hang turns any endpoint into a black hole when the hang query parameter is
+// true or a duration.
+func hang(max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, err := hangParam(r, max)
+			if err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process hang"))
+				return
+			}
+			if d == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := blackhole(w, d); err != nil {
+				writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hang connection"))
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// bufferedWriter holds back the status code and body written by a handler
+// so that middleware can inspect or rewrite them before they are sent.
+// Headers are shared with the underlying writer.
+type bufferedWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newBufferedWriter(w http.ResponseWriter) *bufferedWriter {
+	return &bufferedWriter{ResponseWriter: w, code: http.StatusOK}
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		bw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !bw.wroteHeader {
+		bw.code, bw.wroteHeader = code, true
+	}
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	return bw.body.Write(b)
+}
+
+// Flush is a no-op: nothing is sent until the handler is done.
+func (bw *bufferedWriter) Flush() {}
+
+// send writes the buffered response, with body in place of the one the
+// handler wrote.
+func (bw *bufferedWriter) send(body []byte) {
+	bw.Header().Del("Content-Length")
+	bw.ResponseWriter.WriteHeader(bw.code)
+	bw.ResponseWriter.Write(body)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// maxBytes caps the size of generated binary bodies.
+const maxBytes = 10 << 20
+
+// BytesHandler writes n bytes of pseudo-random data. The data is
+// deterministic for a given seed query parameter (default 0).
+func BytesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	n, err := strconv.ParseInt(vars["n"], 10, 0)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process size"))
+		return
+	}
+	if n < 0 || n > maxBytes {
+		badRequest(w, errors.Errorf("Size must be between 0 and %d", maxBytes))
+		return
+	}
+
+	var seed int64
+	if v := r.URL.Query().Get("seed"); v != "" {
+		seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process seed"))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	io.CopyN(w, rand.New(rand.NewSource(seed)), n)
+}
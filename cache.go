@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// startTime is reported as the Last-Modified time of cacheable responses.
+var startTime = time.Now().UTC().Truncate(time.Second)
+
+// CacheHandler responds like /status/{code} with validators attached. When
+// the code is a 2xx, matching conditional requests get a 304 Not Modified
+// instead. The etag query parameter overrides the default entity tag.
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	etag := r.URL.Query().Get("etag")
+	if etag == "" {
+		etag = "code-" + strconv.Itoa(code)
+	}
+	etag = strconv.Quote(strings.Trim(etag, `"`))
+
+	cc, err := cacheControl(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", startTime.Format(http.TimeFormat))
+	if code >= 200 && code < 300 && notModified(r, etag, startTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	StatusHandler(w, r)
+}
+
+// CacheControlHandler responds with a 200, or the code query parameter,
+// carrying a Cache-Control header built from the query parameters.
+func CacheControlHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		code = strconv.Itoa(http.StatusOK)
+	}
+	if _, err := checkCode(r, code); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	cc, err := cacheControl(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": code}))
+}
+
+var (
+	cacheDurations = []string{"max-age", "s-maxage", "stale-while-revalidate", "stale-if-error"}
+	cacheFlags     = []string{"public", "private", "no-cache", "no-store", "must-revalidate",
+		"proxy-revalidate", "no-transform", "immutable", "must-understand"}
+)
+
+// cacheControl builds a Cache-Control value from query parameters named
+// after its directives, such as max-age=60 or public=true.
+func cacheControl(r *http.Request) (string, error) {
+	var directives []string
+	for _, name := range cacheDurations {
+		if v := r.URL.Query().Get(name); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds < 0 {
+				return "", errors.Errorf("Invalid %s %q", name, v)
+			}
+			directives = append(directives, name+"="+strconv.Itoa(seconds))
+		}
+	}
+	for _, name := range cacheFlags {
+		set, err := boolParam(r, name)
+		if err != nil {
+			return "", errors.Wrapf(err, "Unable to process %s", name)
+		}
+		if set {
+			directives = append(directives, name)
+		}
+	}
+	return strings.Join(directives, ", "), nil
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is
+// no If-None-Match, against the current validators.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag, true)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
+
+// etagMatches reports whether etag is in the comma-separated list, which
+// may also be "*". Weak comparison ignores W/ prefixes.
+func etagMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate, etag = strings.TrimPrefix(candidate, "W/"), strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
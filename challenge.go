@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("challenge", "realm")
+}
+
+// challenges builds each supported authentication scheme's challenge.
+var challenges = map[string]func(realm string) string{
+	"basic": func(realm string) string {
+		return fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+	},
+	"bearer": func(realm string) string {
+		return fmt.Sprintf(`Bearer realm=%q`, realm)
+	},
+	"digest": func(realm string) string {
+		return fmt.Sprintf(`Digest realm=%q, qop="auth", algorithm=SHA-256, nonce=%q, opaque=%q`,
+			realm, randomHex(16), randomHex(16))
+	},
+	"negotiate": func(string) string {
+		return "Negotiate"
+	},
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authChallenge adds the challenge named by the challenge query parameter to
+// 401 responses as WWW-Authenticate and to 407 responses as
+// Proxy-Authenticate. The realm query parameter defaults to "httpcodes".
+func authChallenge(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("challenge")
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		challenge, ok := challenges[strings.ToLower(name)]
+		if !ok {
+			badRequest(w, errors.Errorf("Unsupported challenge %q", name))
+			return
+		}
+		realm := r.URL.Query().Get("realm")
+		if realm == "" {
+			realm = "httpcodes"
+		}
+
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, hook: func(code int) {
+			switch code {
+			case http.StatusUnauthorized:
+				w.Header().Set("WWW-Authenticate", challenge(realm))
+			case http.StatusProxyAuthRequired:
+				w.Header().Set("Proxy-Authenticate", challenge(realm))
+			}
+		}}, r)
+	})
+}
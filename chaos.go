@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// chaosFaults are the faults injected into a request. Durations are written
+// as for the delay query parameter.
+type chaosFaults struct {
+	ErrorRate float64 `json:"error_rate"`
+	ErrorCode int     `json:"error_code,omitempty"`
+	Latency   string  `json:"latency,omitempty"`
+	Jitter    string  `json:"jitter,omitempty"`
+	ResetRate float64 `json:"reset_rate"`
+
+	latency, jitter time.Duration
+}
+
+// validate checks the faults and parses their durations.
+func (f *chaosFaults) validate(maxDelay time.Duration) error {
+	if f.ErrorRate < 0 || f.ResetRate < 0 || f.ErrorRate+f.ResetRate > 1 {
+		return errors.New("error_rate and reset_rate must be between 0 and 1 together")
+	}
+	if f.ErrorCode == 0 {
+		f.ErrorCode = http.StatusInternalServerError
+	}
+	if f.ErrorCode < 100 || f.ErrorCode > 599 {
+		return errors.Errorf("Invalid error_code %d", f.ErrorCode)
+	}
+	var err error
+	if f.Latency != "" {
+		if f.latency, err = parseDuration(f.Latency); err != nil {
+			return errors.Wrap(err, "Unable to process latency")
+		}
+	}
+	if f.Jitter != "" {
+		if f.jitter, err = parseDuration(f.Jitter); err != nil {
+			return errors.Wrap(err, "Unable to process jitter")
+		}
+	}
+	if f.latency+f.jitter > maxDelay {
+		return errors.Errorf("latency plus jitter must not exceed %s", maxDelay)
+	}
+	return nil
+}
+
+// chaosMatch selects the requests a rule applies to. Every condition given
+// must hold: ip is an address or CIDR range for the client, header is
+// "Name" or "Name: value", and token must equal the X-Chaos-Token header.
+type chaosMatch struct {
+	IP     string `json:"ip,omitempty"`
+	Header string `json:"header,omitempty"`
+	Token  string `json:"token,omitempty"`
+
+	network *net.IPNet
+}
+
+func (m *chaosMatch) validate() error {
+	if m.IP == "" && m.Header == "" && m.Token == "" {
+		return errors.New("match needs at least one of ip, header or token")
+	}
+	if m.IP != "" {
+		network, err := parseCIDR(m.IP)
+		if err != nil {
+			return errors.Errorf("Invalid match ip %q", m.IP)
+		}
+		m.network = network
+	}
+	if name, _, _ := strings.Cut(m.Header, ":"); m.Header != "" && !validHeaderName(strings.TrimSpace(name)) {
+		return errors.Errorf("Invalid match header %q", m.Header)
+	}
+	return nil
+}
+
+func (m *chaosMatch) matches(r *http.Request) bool {
+	if m.network != nil {
+		if ip := hostIP(r.RemoteAddr); ip == nil || !m.network.Contains(ip) {
+			return false
+		}
+	}
+	if m.Header != "" {
+		name, value, hasValue := strings.Cut(m.Header, ":")
+		values := r.Header.Values(strings.TrimSpace(name))
+		if len(values) == 0 || (hasValue && !containsFold(values, strings.TrimSpace(value))) {
+			return false
+		}
+	}
+	if m.Token != "" && r.Header.Get("X-Chaos-Token") != m.Token {
+		return false
+	}
+	return true
+}
+
+// chaosRule applies its faults, instead of the profile's defaults, to the
+// requests it matches.
+type chaosRule struct {
+	Match chaosMatch `json:"match"`
+	chaosFaults
+}
+
+// chaosProfile is the fault injection applied to every request: the faults
+// of the first matching rule, or the default faults when none match.
+type chaosProfile struct {
+	chaosFaults
+	Rules []chaosRule `json:"rules,omitempty"`
+}
+
+func (p *chaosProfile) validate(maxDelay time.Duration) error {
+	if err := p.chaosFaults.validate(maxDelay); err != nil {
+		return err
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].Match.validate(); err != nil {
+			return errors.Wrapf(err, "Invalid rule %d", i)
+		}
+		if err := p.Rules[i].chaosFaults.validate(maxDelay); err != nil {
+			return errors.Wrapf(err, "Invalid rule %d", i)
+		}
+	}
+	return nil
+}
+
+// faults returns the faults to inject into r.
+func (p *chaosProfile) faults(r *http.Request) chaosFaults {
+	for _, rule := range p.Rules {
+		if rule.Match.matches(r) {
+			return rule.chaosFaults
+		}
+	}
+	return p.chaosFaults
+}
+
+// chaos holds the current chaos profile, which the admin API can change at
+// runtime.
+type chaos struct {
+	mu      sync.Mutex
+	profile chaosProfile
+	rnd     *rand.Rand
+}
+
+func newChaos() *chaos {
+	return &chaos{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (c *chaos) get() chaosProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.profile
+}
+
+func (c *chaos) set(p chaosProfile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profile = p
+}
+
+// roll returns the faults for r along with a random number for picking one
+// and the jitter to add to their latency.
+func (c *chaos) roll(r *http.Request) (chaosFaults, float64, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.profile.faults(r)
+	var jitter time.Duration
+	if f.jitter > 0 {
+		jitter = time.Duration(c.rnd.Int63n(int64(f.jitter) + 1))
+	}
+	return f, c.rnd.Float64(), jitter
+}
+
+// chaosInjection applies the current chaos profile to every request outside
+// the admin API: added latency, then either a connection reset, an error
+// response or the normal response.
+func chaosInjection(c *chaos) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			p, n, jitter := c.roll(r)
+			if d := p.latency + jitter; d > 0 {
+				extendDeadline(r, d)
+				if !sleep(r, d) {
+					return
+				}
+			}
+			switch {
+			case n < p.ResetRate:
+				ResetHandler(w, r)
+			case n < p.ResetRate+p.ErrorRate:
+				StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(p.ErrorCode)}))
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// ChaosHandler reads and changes the chaos profile: GET returns it, PUT
+// replaces it and DELETE turns chaos off.
+func ChaosHandler(c *chaos, maxDelay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPost:
+			var p chaosProfile
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&p); err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process chaos profile"))
+				return
+			}
+			if err := p.validate(maxDelay); err != nil {
+				badRequest(w, err)
+				return
+			}
+			c.set(p)
+		case http.MethodDelete:
+			c.set(chaosProfile{})
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(c.get())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+func init() {
+	globalParam("charset", "bom")
+}
+
+var byteOrderMarks = map[string][]byte{
+	"utf-8":    {0xef, 0xbb, 0xbf},
+	"utf-16le": {0xff, 0xfe},
+	"utf-16be": {0xfe, 0xff},
+}
+
+// textCharset describes how a text body is encoded on the wire.
+type textCharset struct {
+	name string
+	enc  encoding.Encoding
+	bom  bool
+}
+
+// charsetParam reads the charset and bom query parameters. Charsets are
+// looked up by their IANA names and aliases, defaulting to utf-8.
+func charsetParam(r *http.Request) (textCharset, error) {
+	label := r.URL.Query().Get("charset")
+	if label == "" {
+		label = "utf-8"
+	}
+	enc, err := ianaindex.MIME.Encoding(label)
+	if err != nil || enc == nil {
+		return textCharset{}, errors.Errorf("unsupported charset %q", label)
+	}
+	name, _ := ianaindex.MIME.Name(enc)
+	name = strings.ToLower(name)
+
+	bom, err := boolParam(r, "bom")
+	if err != nil {
+		return textCharset{}, err
+	}
+	return textCharset{name: name, enc: enc, bom: bom}, nil
+}
+
+// writer returns a writer that encodes into w, prepending a byte order mark
+// if one was requested. Charsets without a byte order mark of their own get
+// the UTF-8 one, mimicking a common misconfiguration. The writer must be
+// closed to flush the encoder.
+func (c textCharset) writer(w io.Writer) io.WriteCloser {
+	if c.bom {
+		bom, ok := byteOrderMarks[c.name]
+		if !ok {
+			bom = byteOrderMarks["utf-8"]
+		}
+		w.Write(bom)
+	}
+	return transform.NewWriter(w, encoding.ReplaceUnsupported(c.enc.NewEncoder()))
+}
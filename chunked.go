@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("chunked")
+}
+
+// chunkSize is how much of the body goes in each chunk of a malformed
+// chunked response.
+const chunkSize = 16
+
+// chunkEncodings write body with broken chunked transfer-coding, by mode.
+var chunkEncodings = map[string]func(buf *bufio.ReadWriter, body []byte){
+	// Chunk sizes that are not hexadecimal.
+	"bad-size": func(buf *bufio.ReadWriter, body []byte) {
+		writeChunks(buf, body, func(n int) string { return fmt.Sprintf("%dg", n) })
+		buf.WriteString("0\r\n\r\n")
+	},
+	// Chunk sizes that claim more data than follows.
+	"short-chunk": func(buf *bufio.ReadWriter, body []byte) {
+		writeChunks(buf, body, func(n int) string { return fmt.Sprintf("%x", n+8) })
+		buf.WriteString("0\r\n\r\n")
+	},
+	// Chunk data not followed by CRLF.
+	"missing-crlf": func(buf *bufio.ReadWriter, body []byte) {
+		for len(body) > 0 {
+			n := len(body)
+			if n > chunkSize {
+				n = chunkSize
+			}
+			fmt.Fprintf(buf, "%x\r\n", n)
+			buf.Write(body[:n])
+			body = body[n:]
+		}
+		buf.WriteString("0\r\n\r\n")
+	},
+	// Valid chunks, but the terminating zero-length chunk never comes.
+	"no-terminator": func(buf *bufio.ReadWriter, body []byte) {
+		writeChunks(buf, body, func(n int) string { return fmt.Sprintf("%x", n) })
+	},
+	// A complete chunked body followed by data that belongs to no message.
+	"trailing-garbage": func(buf *bufio.ReadWriter, body []byte) {
+		writeChunked(buf, body)
+		buf.WriteString("5\r\nextra\r\n0\r\n\r\n")
+	},
+}
+
+// writeChunks writes body as chunks of chunkSize bytes, each announced by
+// the size line that size returns for it.
+func writeChunks(buf *bufio.ReadWriter, body []byte, size func(n int) string) {
+	for len(body) > 0 {
+		n := len(body)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		fmt.Fprintf(buf, "%s\r\n", size(n))
+		buf.Write(body[:n])
+		buf.WriteString("\r\n")
+		body = body[n:]
+	}
+}
+
+// chunkedMalformation sends the response with the broken chunked encoding
+// named by the chunked query parameter, written to the hijacked connection.
+func chunkedMalformation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("chunked")
+		if mode == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		encode, ok := chunkEncodings[mode]
+		if !ok {
+			modes := make([]string, 0, len(chunkEncodings))
+			for m := range chunkEncodings {
+				modes = append(modes, m)
+			}
+			sort.Strings(modes)
+			badRequest(w, errors.Errorf("Unsupported chunked mode %q, expected one of %s", mode, strings.Join(modes, ", ")))
+			return
+		}
+
+		bw := newBufferedWriter(w)
+		next.ServeHTTP(bw, r)
+
+		w.Header().Del("Content-Length")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		conn, buf, err := hijackResponse(w, bw.code, r.URL.Query().Get("reason"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hijack connection"))
+			return
+		}
+		defer conn.Close()
+		if r.Method != http.MethodHead {
+			encode(buf, bw.body.Bytes())
+		}
+		buf.Flush()
+
+		linger(conn, buf)
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("encoding", "corrupt")
+}
+
+// encoders are the supported content codings, in order of preference.
+var encoders = []struct {
+	name    string
+	newFunc func(io.Writer) io.WriteCloser
+}{
+	{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+	{"deflate", func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}},
+}
+
+// compression compresses response bodies using the coding named by the
+// encoding query parameter, falling back to the Accept-Encoding header.
+//
+// The corrupt query parameter deliberately breaks the encoding: "true" or
+// "plain" advertises the coding but writes the body uncompressed, and
+// "truncate" ends the compressed stream without its final block.
+func compression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		if encoding == "" {
+			encoding = acceptEncoding(r.Header.Values("Accept-Encoding"))
+		}
+		if encoding == "" || encoding == "identity" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		corrupt := r.URL.Query().Get("corrupt")
+		switch corrupt {
+		case "", "false":
+			corrupt = ""
+		case "true", "plain":
+			corrupt = "plain"
+		case "truncate":
+		default:
+			badRequest(w, errors.Errorf("Unsupported corrupt mode %q", corrupt))
+			return
+		}
+
+		for _, e := range encoders {
+			if e.name == encoding {
+				cw := &compressWriter{ResponseWriter: w, encoding: e.name, newFunc: e.newFunc, corrupt: corrupt}
+				defer cw.Close()
+				next.ServeHTTP(cw, r)
+				return
+			}
+		}
+		badRequest(w, errors.Errorf("Unsupported encoding %q", encoding))
+	})
+}
+
+// acceptEncoding returns the most preferred supported coding allowed by the
+// Accept-Encoding header, or "" if none is.
+func acceptEncoding(header []string) string {
+	best, bestQ := "", 0.0
+	for _, e := range encoders {
+		q, explicit := 0.0, false
+		for _, h := range header {
+			for _, part := range strings.Split(h, ",") {
+				name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name != e.name && (name != "*" || explicit) {
+					continue
+				}
+				explicit = name == e.name
+				q = 1
+				if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+					if f, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+						q = f
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = e.name, q
+		}
+	}
+	return best
+}
+
+// compressWriter encodes everything written to it once the status code
+// shows the response has a body.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	newFunc     func(io.Writer) io.WriteCloser
+	enc         io.WriteCloser
+	corrupt     string
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	h.Add("Vary", "Accept-Encoding")
+	bodyless := code == http.StatusNoContent || code == http.StatusNotModified
+	if !bodyless && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.corrupt != "plain" {
+			cw.enc = cw.newFunc(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.enc.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) Close() error {
+	if cw.enc == nil {
+		return nil
+	}
+	if cw.corrupt == "truncate" {
+		if f, ok := cw.enc.(interface{ Flush() error }); ok {
+			return f.Flush()
+		}
+		return nil
+	}
+	return cw.enc.Close()
+}
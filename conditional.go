@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// preconditionFailed evaluates If-Match, or If-Unmodified-Since when there is
+// no If-Match, against the current validators of a resource, if it exists.
+func preconditionFailed(r *http.Request, etag string, modified time.Time, exists bool) bool {
+	if im := r.Header.Get("If-Match"); im != "" {
+		return !exists || !etagMatches(im, etag, false)
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		t, err := http.ParseTime(ius)
+		return err == nil && (!exists || modified.Truncate(time.Second).After(t))
+	}
+	return false
+}
+
+// hasPrecondition reports whether r carries If-Match or If-Unmodified-Since.
+func hasPrecondition(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != ""
+}
+
+type versioned struct {
+	Name     string          `json:"name"`
+	Version  int             `json:"version"`
+	Modified time.Time       `json:"modified"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func (v *versioned) etag() string {
+	return fmt.Sprintf(`"v%d"`, v.Version)
+}
+
+// versions keeps the resources behind /conditional in the state store at
+// version:{name}, until ttl after they were last written. Only writes store
+// a resource; until then it reads as version 1 with null data.
+type versions struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newVersions(store Store, ttl time.Duration) *versions {
+	return &versions{store: store, ttl: ttl}
+}
+
+// get returns the resource and its stored form, or a new one at version 1,
+// modified at the Unix epoch so that it validates the same on every read,
+// and nil if it does not exist.
+func (vs *versions) get(name string) (*versioned, []byte, error) {
+	raw, ok, err := vs.store.Get("version:" + name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return &versioned{Name: name, Version: 1, Modified: time.Unix(0, 0).UTC(), Data: json.RawMessage("null")}, nil, nil
+	}
+	var v versioned
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, nil, errors.Wrapf(err, "Unable to process resource %q", name)
+	}
+	return &v, raw, nil
+}
+
+// ConditionalHandler serves a versioned JSON resource for optimistic
+// concurrency. Resources start at version 1 with null data and expire
+// CONDITIONAL_TTL after their last write. PUT replaces the data and DELETE
+// resets the resource, but both need If-Match or If-Unmodified-Since,
+// answering 428 without one and 412 when it doesn't hold.
+func ConditionalHandler(vs *versions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		var data []byte
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+		case http.MethodPut:
+			var err error
+			if data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize)); err != nil {
+				writeError(w, http.StatusRequestEntityTooLarge, errors.Wrap(err, "Unable to read body"))
+				return
+			}
+			if !json.Valid(data) {
+				badRequest(w, errors.New("Body is not valid JSON"))
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+
+		// Retry until the resource is not changed by another request
+		// between reading and writing it.
+		var current versioned
+		var code int
+		for {
+			v, raw, err := vs.get(name)
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			var value []byte
+			code = http.StatusOK
+			switch {
+			case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			case !hasPrecondition(r):
+				code = http.StatusPreconditionRequired
+			case preconditionFailed(r, v.etag(), v.Modified, true):
+				code = http.StatusPreconditionFailed
+			case r.Method == http.MethodPut:
+				v.Version++
+				v.Modified, v.Data = time.Now().UTC(), data
+				value, _ = json.Marshal(v)
+			case r.Method == http.MethodDelete:
+				code = http.StatusNoContent
+			}
+			current = *v
+			if value == nil && code != http.StatusNoContent {
+				break
+			}
+			swapped, err := vs.store.CompareAndSwap("version:"+name, raw, value, vs.ttl)
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			if swapped {
+				break
+			}
+		}
+
+		switch code {
+		case http.StatusPreconditionRequired:
+			writeError(w, code, errors.New("Modifying a resource requires If-Match or If-Unmodified-Since"))
+			return
+		case http.StatusPreconditionFailed:
+			w.Header().Set("ETag", current.etag())
+			writeError(w, code, errors.Errorf("Precondition failed, the resource is at version %d", current.Version))
+			return
+		case http.StatusNoContent:
+			w.WriteHeader(code)
+			return
+		}
+		w.Header().Set("ETag", current.etag())
+		w.Header().Set("Last-Modified", current.Modified.Format(http.TimeFormat))
+		if notModified(r, current.etag(), current.Modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(current)
+	}
+}
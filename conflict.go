@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("conflict", "dup-header")
+}
+
+// framingConflicts describe responses whose framing headers disagree, by
+// mode: the header lines to send and how to write the body.
+var framingConflicts = map[string]struct {
+	lines   func(n int) []string
+	chunked bool
+}{
+	// Content-Length alongside Transfer-Encoding: chunked.
+	"cl-te": {func(n int) []string {
+		return []string{fmt.Sprintf("Content-Length: %d", n), "Transfer-Encoding: chunked"}
+	}, true},
+	// Two Content-Length headers with different values.
+	"cl-cl": {func(n int) []string {
+		return []string{fmt.Sprintf("Content-Length: %d", n), fmt.Sprintf("Content-Length: %d", n+10)}
+	}, false},
+	// Transfer-Encoding given twice, chunked and identity.
+	"te-te": {func(n int) []string {
+		return []string{"Transfer-Encoding: chunked", "Transfer-Encoding: identity"}
+	}, true},
+	// Transfer-Encoding with whitespace before the colon, which some parsers
+	// honour and others ignore in favour of Content-Length.
+	"te-space": {func(n int) []string {
+		return []string{fmt.Sprintf("Content-Length: %d", n), "Transfer-Encoding : chunked"}
+	}, true},
+}
+
+// headerConflicts writes responses with duplicated or conflicting headers to
+// the hijacked connection. Each dup-header query parameter repeats a header,
+// either as Name to send its current value twice or as Name:value to add a
+// second, different value. The conflict parameter picks one of the
+// framingConflicts.
+func headerConflicts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		dups, mode := q["dup-header"], q.Get("conflict")
+		if len(dups) == 0 && mode == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		conflict, ok := framingConflicts[mode]
+		if mode != "" && !ok {
+			modes := make([]string, 0, len(framingConflicts))
+			for m := range framingConflicts {
+				modes = append(modes, m)
+			}
+			sort.Strings(modes)
+			badRequest(w, errors.Errorf("Unsupported conflict %q, expected one of %s", mode, strings.Join(modes, ", ")))
+			return
+		}
+		for _, d := range dups {
+			name, _, _ := strings.Cut(d, ":")
+			if !validHeaderName(strings.TrimSpace(name)) {
+				badRequest(w, errors.Errorf("Invalid dup-header %q", d))
+				return
+			}
+		}
+
+		bw := newBufferedWriter(w)
+		next.ServeHTTP(bw, r)
+		body := bw.body.Bytes()
+
+		var lines []string
+		for _, d := range dups {
+			name, value, ok := strings.Cut(d, ":")
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if !ok {
+				value = w.Header().Get(name)
+			}
+			lines = append(lines, name+": "+strings.TrimSpace(value))
+		}
+		if mode != "" {
+			w.Header().Del("Content-Length")
+			w.Header().Del("Transfer-Encoding")
+			lines = append(lines, conflict.lines(len(body))...)
+		} else if w.Header().Get("Content-Length") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+
+		conn, buf, err := hijackResponse(w, bw.code, q.Get("reason"), lines...)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hijack connection"))
+			return
+		}
+		defer conn.Close()
+		switch {
+		case r.Method == http.MethodHead:
+		case conflict.chunked:
+			writeChunked(buf, body)
+		default:
+			buf.Write(body)
+		}
+		buf.Flush()
+
+		linger(conn, buf)
+	})
+}
+
+// writeChunked writes body with valid chunked transfer-coding.
+func writeChunked(buf *bufio.ReadWriter, body []byte) {
+	writeChunks(buf, body, func(n int) string { return fmt.Sprintf("%x", n) })
+	buf.WriteString("0\r\n\r\n")
+}
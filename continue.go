@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ContinueHandler controls how a request with Expect: 100-continue is
+// answered, according to the mode query parameter:
+//
+//	accept  read the body, which sends 100 Continue, then respond (default)
+//	delay   wait for the continue-delay query parameter, no more than max,
+//	        before reading the body
+//	reject  respond 417 Expectation Failed without reading the body
+//	final   respond with the code without reading the body
+func ContinueHandler(max time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := parseCode(r); err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		delay, err := durationParam(r, "continue-delay", time.Second)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process continue-delay"))
+			return
+		}
+		if delay > max {
+			badRequest(w, errors.Errorf("Continue delay must not exceed %s", max))
+			return
+		}
+
+		switch r.URL.Query().Get("mode") {
+		case "", "accept":
+		case "delay":
+			extendDeadline(r, delay)
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+		case "reject":
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		case "final":
+			w.Header().Set("Connection", "close")
+			StatusHandler(w, r)
+			return
+		default:
+			badRequest(w, errors.Errorf("Unsupported mode %q", r.URL.Query().Get("mode")))
+			return
+		}
+
+		n, _ := io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Received-Bytes", strconv.FormatInt(n, 10))
+		StatusHandler(w, r)
+	}
+}
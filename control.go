@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// controlHeaders maps request headers to the query parameters they stand in
+// for, for clients whose URLs can't be changed.
+var controlHeaders = []struct {
+	header string
+	param  string
+}{
+	{"X-HttpCodes-Status", "code"},
+	{"X-HttpCodes-Delay", "delay"},
+	{"X-HttpCodes-Body", "body"},
+}
+
+// headerControls lets the X-HttpCodes-* request headers override the matching
+// query parameters on any route. X-HttpCodes-Status also replaces the code in
+// the path of routes that have one.
+func headerControls(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		changed := false
+		for _, c := range controlHeaders {
+			v := r.Header.Get(c.header)
+			if v == "" {
+				continue
+			}
+			w.Header().Add("Vary", c.header)
+			query.Set(c.param, v)
+			changed = true
+		}
+		if !changed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = query.Encode()
+		if code := r.Header.Get("X-HttpCodes-Status"); code != "" {
+			vars := mux.Vars(r)
+			if _, ok := vars["code"]; ok {
+				overridden := map[string]string{}
+				for k, v := range vars {
+					overridden[k] = v
+				}
+				overridden["code"] = code
+				r = mux.SetURLVars(r, overridden)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cookieAttributes are the query parameters that control cookie attributes
+// rather than naming a cookie. The Secure attribute is cookie-secure, as
+// secure is taken by secureHeaders.
+var cookieAttributes = map[string]bool{
+	"path":          true,
+	"domain":        true,
+	"max-age":       true,
+	"expires":       true,
+	"cookie-secure": true,
+	"httponly":      true,
+	"samesite":      true,
+}
+
+// cookieTemplate builds a cookie carrying the attributes given in the query
+// string.
+func cookieTemplate(r *http.Request) (http.Cookie, error) {
+	q := r.URL.Query()
+	c := http.Cookie{Path: q.Get("path"), Domain: q.Get("domain")}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	if q.Get("max-age") != "" {
+		maxAge, err := intParam(r, "max-age", 0)
+		if err != nil {
+			return c, errors.Wrap(err, "Unable to process max-age")
+		}
+		// A zero MaxAge means "unset" to net/http; negative sends Max-Age=0.
+		c.MaxAge = maxAge
+		if maxAge == 0 {
+			c.MaxAge = -1
+		}
+	}
+	if v := q.Get("expires"); v != "" {
+		when, err := parseDate(v)
+		if err != nil {
+			return c, errors.Errorf("Invalid expires %q", v)
+		}
+		c.Expires = when
+	}
+
+	var err error
+	if c.Secure, err = boolParam(r, "cookie-secure"); err != nil {
+		return c, errors.Wrap(err, "Unable to process cookie-secure")
+	}
+	if c.HttpOnly, err = boolParam(r, "httponly"); err != nil {
+		return c, errors.Wrap(err, "Unable to process httponly")
+	}
+	switch v := strings.ToLower(q.Get("samesite")); v {
+	case "":
+	case "lax":
+		c.SameSite = http.SameSiteLaxMode
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	default:
+		return c, errors.Errorf("Invalid samesite %q", v)
+	}
+	return c, nil
+}
+
+// cookieNames returns the query parameters that name cookies, leaving out
+// the attributes and the global parameters such as delay.
+func cookieNames(r *http.Request) map[string][]string {
+	names := map[string][]string{}
+	for name, values := range r.URL.Query() {
+		if lower := strings.ToLower(name); !cookieAttributes[lower] && !globalParams[lower] {
+			names[name] = values
+		}
+	}
+	return names
+}
+
+// setCookies adds a Set-Cookie header for each cookie, sorted by name. It
+// reports a bad request and returns false if any cookie is invalid.
+func setCookies(w http.ResponseWriter, cookies []http.Cookie) bool {
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i].Name < cookies[j].Name })
+	for _, c := range cookies {
+		if c.String() == "" {
+			badRequest(w, errors.Errorf("Invalid cookie name %q", c.Name))
+			return false
+		}
+	}
+	for i := range cookies {
+		http.SetCookie(w, &cookies[i])
+	}
+	return true
+}
+
+// CookiesHandler echoes the cookies sent with the request.
+func CookiesHandler(w http.ResponseWriter, r *http.Request) {
+	cookies := map[string]string{}
+	for _, c := range r.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	json.NewEncoder(w).Encode(map[string]interface{}{"cookies": cookies})
+}
+
+// SetCookiesHandler sets a cookie for every name=value query parameter, with
+// the attributes from cookieTemplate, then redirects to /cookies.
+func SetCookiesHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := cookieTemplate(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	var cookies []http.Cookie
+	for name, values := range cookieNames(r) {
+		c := tmpl
+		c.Name, c.Value = name, values[0]
+		cookies = append(cookies, c)
+	}
+	if !setCookies(w, cookies) {
+		return
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
+
+// DeleteCookiesHandler expires every cookie named in the query string, then
+// redirects to /cookies. path and domain must match the original cookie.
+func DeleteCookiesHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := cookieTemplate(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	var cookies []http.Cookie
+	for name := range cookieNames(r) {
+		c := tmpl
+		c.Name, c.MaxAge, c.Expires = name, -1, time.Unix(0, 0)
+		cookies = append(cookies, c)
+	}
+	if !setCookies(w, cookies) {
+		return
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("cors", "cors-credentials", "cors-origin", "cors-methods", "cors-headers", "cors-expose", "cors-max-age")
+}
+
+// corsOptions are read from the cors-* query parameters.
+type corsOptions struct {
+	origin      string
+	methods     string
+	headers     string
+	expose      string
+	credentials bool
+	maxAge      int
+}
+
+// corsParams reports whether CORS was asked for, via cors=true or any cors-*
+// parameter, and with which options.
+func corsParams(r *http.Request) (corsOptions, bool, error) {
+	query := r.URL.Query()
+	enabled := false
+	for name := range query {
+		if strings.HasPrefix(name, "cors-") {
+			enabled = true
+		}
+	}
+	on, err := boolParam(r, "cors")
+	if err != nil {
+		return corsOptions{}, false, errors.Wrap(err, "Unable to process cors")
+	}
+	if !enabled && !on {
+		return corsOptions{}, false, nil
+	}
+
+	opts := corsOptions{
+		origin:  query.Get("cors-origin"),
+		methods: query.Get("cors-methods"),
+		headers: query.Get("cors-headers"),
+		expose:  query.Get("cors-expose"),
+		maxAge:  -1,
+	}
+	if opts.credentials, err = boolParam(r, "cors-credentials"); err != nil {
+		return corsOptions{}, false, errors.Wrap(err, "Unable to process cors-credentials")
+	}
+	if v := query.Get("cors-max-age"); v != "" {
+		if opts.maxAge, err = strconv.Atoi(v); err != nil {
+			return corsOptions{}, false, errors.Wrap(err, "Unable to process cors-max-age")
+		}
+	}
+	return opts, true, nil
+}
+
+// cors answers preflight requests and adds CORS headers to responses when
+// asked to by the query string:
+//
+//	cors-origin       echo (default) to reflect Origin, * or a fixed origin
+//	cors-methods      allowed methods; defaults to the requested method
+//	cors-headers      allowed headers; defaults to the requested headers
+//	cors-expose       Access-Control-Expose-Headers
+//	cors-credentials  send Access-Control-Allow-Credentials: true
+//	cors-max-age      Access-Control-Max-Age in seconds for preflights
+//
+// Any combination is allowed, including ones browsers reject, so that CORS
+// failures can be reproduced.
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts, enabled, err := corsParams(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		if !enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		switch opts.origin {
+		case "", "echo":
+			if origin := r.Header.Get("Origin"); origin != "" {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+		default:
+			h.Set("Access-Control-Allow-Origin", opts.origin)
+		}
+		if opts.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if opts.expose != "" {
+			h.Set("Access-Control-Expose-Headers", opts.expose)
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		methods := opts.methods
+		if methods == "" {
+			methods = r.Header.Get("Access-Control-Request-Method")
+		}
+		h.Set("Access-Control-Allow-Methods", methods)
+		headers := opts.headers
+		if headers == "" {
+			headers = r.Header.Get("Access-Control-Request-Headers")
+		}
+		if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if opts.maxAge >= 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(opts.maxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
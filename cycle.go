@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// counters tracks how many times each key has been seen, in the state store
+// under prefix. A counter is forgotten once it has not been hit for ttl.
+type counters struct {
+	store  Store
+	prefix string
+	ttl    time.Duration
+}
+
+func newCounters(store Store, prefix string, ttl time.Duration) *counters {
+	return &counters{store: store, prefix: prefix, ttl: ttl}
+}
+
+// next returns how many times key was seen before and records another hit,
+// within the caller's session if it has one.
+func (c *counters) next(r *http.Request, key string) (int, error) {
+	key, ttl := scopedKey(r, c.prefix+key, c.ttl)
+	n, err := c.store.Incr(key, ttl)
+	return int(n - 1), err
+}
+
+// clientKey identifies the caller for per-client state, preferring the
+// X-Client-Id header, then the client_id cookie, then the remote IP.
+func clientKey(r *http.Request) string {
+	if id := r.Header.Get("X-Client-Id"); id != "" {
+		return "header:" + id
+	}
+	if c, err := r.Cookie("client_id"); err == nil && c.Value != "" {
+		return "cookie:" + c.Value
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// CycleHandler responds with each code of a comma-separated list in turn,
+// starting over after the last. Each client cycles independently.
+func CycleHandler(c *counters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := mux.Vars(r)["codes"]
+		codes := strings.Split(list, ",")
+		for _, code := range codes {
+			if _, err := checkCode(r, code); err != nil {
+				badRequest(w, err)
+				return
+			}
+		}
+
+		n, err := c.next(r, clientKey(r)+" "+list)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": codes[n%len(codes)]}))
+	}
+}
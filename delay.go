@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("delay", "jitter", "header-delay", "body-delay", "seed")
+}
+
+// sleep waits for d, returning false if the request is cancelled first.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// distributions sample a delay in milliseconds from the given parameters,
+// which have already been checked to be positive.
+var distributions = map[string]struct {
+	params int
+	sample func(rnd *rand.Rand, p []float64) float64
+}{
+	// normal(mean, stddev)
+	"normal": {2, func(rnd *rand.Rand, p []float64) float64 {
+		return p[0] + p[1]*rnd.NormFloat64()
+	}},
+	// lognormal(median, sigma)
+	"lognormal": {2, func(rnd *rand.Rand, p []float64) float64 {
+		return p[0] * math.Exp(p[1]*rnd.NormFloat64())
+	}},
+	// pareto(minimum, alpha)
+	"pareto": {2, func(rnd *rand.Rand, p []float64) float64 {
+		return p[0] / math.Pow(1-rnd.Float64(), 1/p[1])
+	}},
+	// exponential(mean)
+	"exponential": {1, func(rnd *rand.Rand, p []float64) float64 {
+		return p[0] * rnd.ExpFloat64()
+	}},
+	// uniform(low, high)
+	"uniform": {2, func(rnd *rand.Rand, p []float64) float64 {
+		return p[0] + (p[1]-p[0])*rnd.Float64()
+	}},
+}
+
+// parseDelay parses a delay, either a fixed duration or a distribution such
+// as normal(200,50) with its scale parameters in milliseconds. Samples are
+// clamped to the range 0 to max; fixed delays and distribution parameters
+// above max are rejected.
+func parseDelay(v string, rnd *rand.Rand, max time.Duration) (time.Duration, error) {
+	open := strings.IndexByte(v, '(')
+	if open < 0 {
+		d, err := parseDuration(v)
+		if err == nil && d > max {
+			err = errors.Errorf("must not exceed %s", max)
+		}
+		return d, err
+	}
+	if !strings.HasSuffix(v, ")") {
+		return 0, errors.Errorf("missing ) in %q", v)
+	}
+
+	name := strings.ToLower(v[:open])
+	dist, ok := distributions[name]
+	if !ok {
+		return 0, errors.Errorf("unknown distribution %q", name)
+	}
+	args := strings.Split(v[open+1:len(v)-1], ",")
+	if len(args) != dist.params {
+		return 0, errors.Errorf("%s takes %d parameters", name, dist.params)
+	}
+	p := make([]float64, len(args))
+	for i, arg := range args {
+		f, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+		if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, errors.Errorf("invalid %s parameter %q", name, arg)
+		}
+		if f > float64(max/time.Millisecond) {
+			return 0, errors.Errorf("%s parameter %q must not exceed %s", name, arg, max)
+		}
+		p[i] = f
+	}
+	if name == "pareto" && p[1] == 0 {
+		return 0, errors.New("pareto alpha must be positive")
+	}
+	if name == "uniform" && p[1] < p[0] {
+		return 0, errors.New("uniform high must not be below low")
+	}
+
+	ms := dist.sample(rnd, p)
+	switch {
+	case ms < 0 || math.IsNaN(ms):
+		return 0, nil
+	case ms > float64(max/time.Millisecond):
+		return max, nil
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// delay holds the response back for the delay query parameter plus a random
+// amount up to jitter. header-delay additionally waits after the handler has
+// run but before the header is sent, and body-delay waits between the header
+// and the first byte of the body. Together they may not exceed max.
+func delay(max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rnd, err := seedParam(r)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			var d time.Duration
+			if v := r.URL.Query().Get("delay"); v != "" {
+				if d, err = parseDelay(v, rnd, max); err != nil {
+					badRequest(w, errors.Wrap(err, "Unable to process delay"))
+					return
+				}
+			}
+			jitter, err := durationParam(r, "jitter", 0)
+			if err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process jitter"))
+				return
+			}
+			if jitter > max {
+				badRequest(w, errors.Errorf("Jitter must not exceed %s", max))
+				return
+			}
+			if jitter > 0 {
+				d += time.Duration(rnd.Int63n(int64(jitter) + 1))
+			}
+			headerDelay, err := durationParam(r, "header-delay", 0)
+			if err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process header-delay"))
+				return
+			}
+			bodyDelay, err := durationParam(r, "body-delay", 0)
+			if err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process body-delay"))
+				return
+			}
+			if headerDelay+bodyDelay > max {
+				badRequest(w, errors.Errorf("Header and body delays must not exceed %s", max))
+				return
+			}
+			if d > max-headerDelay-bodyDelay {
+				d = max - headerDelay - bodyDelay
+			}
+
+			extendDeadline(r, d+headerDelay+bodyDelay)
+			if !sleep(r, d) {
+				return
+			}
+			if headerDelay > 0 {
+				w = &hookWriter{ResponseWriter: w, hook: func(int) { sleep(r, headerDelay) }}
+			}
+			if bodyDelay > 0 {
+				w = &bodyDelayWriter{ResponseWriter: w, r: r, delay: bodyDelay}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyDelayWriter sends the header as soon as it is written, then waits
+// before the first write of the body.
+type bodyDelayWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	delay   time.Duration
+	started bool
+}
+
+func (bw *bodyDelayWriter) Write(b []byte) (int, error) {
+	if !bw.started && len(b) > 0 {
+		bw.started = true
+		bw.Flush()
+		if !sleep(bw.r, bw.delay) {
+			return 0, bw.r.Context().Err()
+		}
+	}
+	return bw.ResponseWriter.Write(b)
+}
+
+func (bw *bodyDelayWriter) Flush() {
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (bw *bodyDelayWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := bw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (bw *bodyDelayWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("deprecated", "deprecation-link", "sunset")
+}
+
+// parseDate accepts a calendar date, an RFC 3339 timestamp or an HTTP-date.
+func parseDate(v string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return http.ParseTime(v)
+}
+
+// deprecation advertises that the resource is deprecated. The deprecated
+// query parameter is either true, meaning deprecated since the server
+// started, or the date of deprecation; sunset gives the date the resource
+// goes away. The Link to the deprecation policy defaults to the index page
+// and can be changed with deprecation-link.
+func deprecation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if v := q.Get("deprecated"); v != "" {
+			since := startTime
+			if deprecated, err := strconv.ParseBool(v); err == nil {
+				if !deprecated {
+					v = ""
+				}
+			} else if since, err = parseDate(v); err != nil {
+				badRequest(w, errors.Errorf("Invalid deprecated %q", v))
+				return
+			}
+			if v != "" {
+				link := q.Get("deprecation-link")
+				if link == "" {
+					link = "/"
+				}
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"; type=\"text/html\"", link))
+			}
+		}
+		if v := q.Get("sunset"); v != "" {
+			when, err := parseDate(v)
+			if err != nil {
+				badRequest(w, errors.Errorf("Invalid sunset %q", v))
+				return
+			}
+			w.Header().Set("Sunset", when.UTC().Format(http.TimeFormat))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// downloadChunk is how much of a download body is written between flushes.
+const downloadChunk = 32 << 10
+
+// DownloadHandler streams an attachment of the requested size and filename.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	size, err := sizeParam(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process size"))
+		return
+	}
+	if size < 0 {
+		size = 1 << 10
+	}
+
+	filename := path.Base(r.URL.Query().Get("filename"))
+	if filename == "." || filename == "/" {
+		filename = "download.bin"
+	}
+	contentType := mime.TypeByExtension(path.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	chunk := filler(downloadChunk)
+	for remaining := size; remaining > 0; remaining -= downloadChunk {
+		n := int64(downloadChunk)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
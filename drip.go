@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DripHandler trickles a body of the bytes query parameter out in chunk-sized
+// writes, flushed one by one and spread evenly over duration, which may not
+// exceed max.
+func DripHandler(max time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, err := parseCode(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		n := int64(1024)
+		if v := r.URL.Query().Get("bytes"); v != "" {
+			if n, err = parseSize(v); err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process bytes"))
+				return
+			}
+		}
+		if n > maxBytes {
+			badRequest(w, errors.Errorf("Bytes must not exceed %d", maxBytes))
+			return
+		}
+		chunk := int64(64)
+		if v := r.URL.Query().Get("chunk"); v != "" {
+			if chunk, err = parseSize(v); err != nil || chunk < 1 {
+				badRequest(w, errors.Errorf("Invalid chunk %q", v))
+				return
+			}
+		}
+		duration, err := durationParam(r, "duration", 2*time.Second)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process duration"))
+			return
+		}
+		if duration > max {
+			badRequest(w, errors.Errorf("Duration must not exceed %s", max))
+			return
+		}
+
+		body := filler(n)
+		chunks := (n + chunk - 1) / chunk
+		var interval time.Duration
+		if chunks > 0 {
+			interval = duration / time.Duration(chunks)
+		}
+
+		extendDeadline(r, duration)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		w.WriteHeader(code)
+		if r.Method == http.MethodHead {
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		for len(body) > 0 {
+			if !sleep(r, interval) {
+				return
+			}
+			part := body
+			if int64(len(part)) > chunk {
+				part = part[:chunk]
+			}
+			if _, err := w.Write(part); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			body = body[len(part):]
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// enableFullDuplex lets the handler interleave body reads with response
+// writes on HTTP/1.x, where the server would otherwise consume the rest of
+// the body before sending the headers. HTTP/2 is always full duplex. It walks
+// the Unwrap chain looking for the server's own writer and reports whether
+// that worked.
+func enableFullDuplex(w http.ResponseWriter) bool {
+	for {
+		if fd, ok := w.(interface{ EnableFullDuplex() error }); ok {
+			return fd.EnableFullDuplex() == nil
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// EchoHandler streams the request body back as the response with the same
+// Content-Type, one flushed write per read. The upper query parameter
+// upper-cases the body and delay-per-chunk sleeps before each write, bounded
+// by max in total.
+func EchoHandler(max time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upper, err := boolParam(r, "upper")
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process upper"))
+			return
+		}
+		interval, err := durationParam(r, "delay-per-chunk", 0)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process delay-per-chunk"))
+			return
+		}
+		if interval > max {
+			badRequest(w, errors.Errorf("Delay per chunk must not exceed %s", max))
+			return
+		}
+
+		enableFullDuplex(w)
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		flusher, _ := w.(http.Flusher)
+
+		// The headers wait for the first read so that clients sending
+		// Expect: 100-continue get their interim response first.
+		var (
+			spent   time.Duration
+			pending []byte
+		)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				part := buf[:n]
+				if upper {
+					part, pending = upperChunk(pending, part)
+				}
+				if interval > 0 && spent < max {
+					extendDeadline(r, interval)
+					if !sleep(r, interval) {
+						return
+					}
+					spent += interval
+				}
+				if _, err := w.Write(part); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		if len(pending) > 0 {
+			w.Write(bytes.ToUpper(pending))
+		}
+	}
+}
+
+// upperChunk upper-cases pending followed by chunk, holding back a trailing
+// partial rune so characters split across reads survive intact.
+func upperChunk(pending, chunk []byte) ([]byte, []byte) {
+	data := append(pending, chunk...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	return bytes.ToUpper(data[:cut]), append([]byte(nil), data[cut:]...)
+}
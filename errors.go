@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("code")
+}
+
+const (
+	minCode = 100
+	maxCode = 599
+)
+
+// badRequest writes a structured 400 response describing err.
+func badRequest(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, err)
+}
+
+// writeError writes a structured error response with the given status.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}{status, err.Error()})
+}
+
+// writeJSON writes v as an indented JSON response with the given status.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// parseCode reads the status code from the {code} path variable.
+func parseCode(r *http.Request) (int, error) {
+	return checkCode(r, mux.Vars(r)["code"])
+}
+
+// checkCode parses v as a status code. Codes outside 100-599 are rejected
+// unless the strict query parameter is false (or ALLOW_NONSTANDARD_CODES is
+// set), in which case any code from 0 to 9999 is allowed.
+func checkCode(r *http.Request, v string) (int, error) {
+	code, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrap(err, "Unable to process code")
+	}
+	strict, _ := r.Context().Value(strictCodesKey).(bool)
+	if v := r.URL.Query().Get("strict"); v != "" {
+		if strict, err = strconv.ParseBool(v); err != nil {
+			return 0, errors.Wrap(err, "Unable to process strict")
+		}
+	}
+	switch {
+	case strict && (code < minCode || code > maxCode):
+		return 0, errors.Errorf("Code %d is outside %d-%d, pass strict=false to allow it", code, minCode, maxCode)
+	case code < 0 || code > 9999:
+		return 0, errors.Errorf("Code %d must be between 0 and 9999", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("fail", "seed")
+}
+
+// failures answers with an error instead of running the handler for a share
+// of requests. The fail query parameter is a comma separated list of
+// probability:code pairs such as 0.3:500 or 0.1:502,0.05:503; the code
+// defaults to 500.
+func failures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := r.URL.Query().Get("fail")
+		if list == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var codes []string
+		var odds []float64
+		total := 0.0
+		for _, entry := range strings.Split(list, ",") {
+			p, code, ok := strings.Cut(entry, ":")
+			if !ok {
+				code = "500"
+			}
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil || f < 0 || f > 1 {
+				badRequest(w, errors.Errorf("Invalid failure probability %q", p))
+				return
+			}
+			if _, err := checkCode(r, code); err != nil {
+				badRequest(w, err)
+				return
+			}
+			codes = append(codes, code)
+			odds = append(odds, f)
+			total += f
+		}
+		if total > 1 {
+			badRequest(w, errors.New("Failure probabilities must not add up to more than 1"))
+			return
+		}
+
+		rnd, err := seedParam(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		n := rnd.Float64()
+		for i, p := range odds {
+			if n < p {
+				StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": codes[i]}))
+				return
+			}
+			n -= p
+		}
+		next.ServeHTTP(w, r)
+	})
+}
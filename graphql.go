@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type graphQLError struct {
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// GraphQLHandler reports the status code in-band as a GraphQL error. The
+// response itself is a 200 unless the raw query parameter is true.
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	raw, err := boolParam(r, "raw")
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process raw"))
+		return
+	}
+
+	reason := http.StatusText(code)
+	body := struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors,omitempty"`
+	}{}
+	if code >= 400 {
+		body.Errors = []graphQLError{{
+			Message: reason,
+			Extensions: map[string]interface{}{
+				"code":   strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(reason)),
+				"status": code,
+			},
+		}}
+	} else {
+		body.Data = map[string]interface{}{"status": code}
+	}
+
+	status := http.StatusOK
+	if raw {
+		status = code
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if status == http.StatusNoContent {
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
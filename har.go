@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxHARBody caps how much of each request and response body is kept in a
+// HAR entry; the sizes still count the whole body.
+const maxHARBody = 64 * 1024
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// harLog is a bounded ring buffer of the most recent exchanges.
+type harLog struct {
+	mu      sync.Mutex
+	entries []harEntry
+	next    int
+	full    bool
+}
+
+func newHARLog(size int) *harLog {
+	return &harLog{entries: make([]harEntry, size)}
+}
+
+func (h *harLog) add(e harEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the buffered entries, oldest first.
+func (h *harLog) snapshot() []harEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]harEntry{}, h.entries[:h.next]...)
+	}
+	return append(append([]harEntry{}, h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+func (h *harLog) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = make([]harEntry, len(h.entries))
+	h.next, h.full = 0, false
+}
+
+// harBuffer keeps the first maxHARBody bytes written to it and counts the rest.
+type harBuffer struct {
+	bytes.Buffer
+	size int64
+}
+
+func (hb *harBuffer) keep(b []byte) {
+	hb.size += int64(len(b))
+	if room := maxHARBody - hb.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		hb.Write(b)
+	}
+}
+
+// text returns the kept body as HAR text, base64 encoded when it is not
+// valid UTF-8.
+func (hb *harBuffer) text() (string, string) {
+	if utf8.Valid(hb.Bytes()) {
+		return hb.String(), ""
+	}
+	return base64.StdEncoding.EncodeToString(hb.Bytes()), "base64"
+}
+
+// harBody records a request body as the handler reads it, so that streaming
+// handlers are not made to wait for the whole body.
+type harBody struct {
+	io.ReadCloser
+	harBuffer
+}
+
+func (hb *harBody) Read(b []byte) (int, error) {
+	n, err := hb.ReadCloser.Read(b)
+	hb.keep(b[:n])
+	return n, err
+}
+
+// harWriter records the status, headers and body of a response.
+type harWriter struct {
+	http.ResponseWriter
+	harBuffer
+	code     int
+	header   http.Header
+	wrote    time.Time
+	hijacked bool
+}
+
+func (hw *harWriter) WriteHeader(code int) {
+	if hw.code == 0 && (code < 100 || code >= 200) {
+		hw.code, hw.header, hw.wrote = code, hw.Header().Clone(), time.Now()
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *harWriter) Write(b []byte) (int, error) {
+	if hw.code == 0 {
+		hw.WriteHeader(http.StatusOK)
+	}
+	hw.keep(b)
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *harWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (hw *harWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	hw.hijacked = true
+	return h.Hijack()
+}
+
+func (hw *harWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+func harPairs(h map[string][]string) []harNameValue {
+	pairs := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			pairs = append(pairs, harNameValue{name, v})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	pairs := []harNameValue{}
+	for _, c := range cookies {
+		pairs = append(pairs, harNameValue{c.Name, c.Value})
+	}
+	return pairs
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harCapture records every exchange apart from the admin API into h.
+func harCapture(h *harLog) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			header := r.Header.Clone()
+			header.Set("Host", r.Host)
+			req := harRequest{
+				Method:      r.Method,
+				URL:         requestURL(r),
+				HTTPVersion: r.Proto,
+				Cookies:     harCookies(r.Cookies()),
+				Headers:     harPairs(header),
+				QueryString: harPairs(r.URL.Query()),
+				HeadersSize: -1,
+			}
+			body := &harBody{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			hw := &harWriter{ResponseWriter: w}
+			defer func() {
+				end := time.Now()
+				if body.size > 0 {
+					text, encoding := body.text()
+					req.PostData = &harPostData{MimeType: r.Header.Get("Content-Type"), Text: text, Encoding: encoding}
+				}
+				req.BodySize = body.size
+
+				if hw.wrote.IsZero() {
+					hw.wrote = end
+				}
+				if hw.code == 0 && !hw.hijacked {
+					hw.code = http.StatusOK
+				}
+				if hw.header == nil {
+					hw.header = hw.Header().Clone()
+				}
+				res := harResponse{
+					Status:      hw.code,
+					StatusText:  http.StatusText(hw.code),
+					HTTPVersion: r.Proto,
+					Cookies:     harCookies((&http.Response{Header: hw.header}).Cookies()),
+					Headers:     harPairs(hw.header),
+					RedirectURL: hw.header.Get("Location"),
+					HeadersSize: -1,
+					BodySize:    hw.size,
+				}
+				text, encoding := hw.text()
+				res.Content = harContent{Size: hw.size, MimeType: hw.header.Get("Content-Type"), Text: text, Encoding: encoding}
+
+				e := harEntry{
+					StartedDateTime: start,
+					Time:            milliseconds(end.Sub(start)),
+					Request:         req,
+					Response:        res,
+					Timings:         harTimings{Wait: milliseconds(hw.wrote.Sub(start)), Receive: milliseconds(end.Sub(hw.wrote))},
+				}
+				if requestID, ok := r.Context().Value(requestIDKey).(string); ok {
+					e.Comment = "Request " + requestID
+				}
+				if hw.hijacked {
+					e.Comment += ", connection hijacked"
+				}
+				if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+					if ip := hostIP(addr.String()); ip != nil {
+						e.ServerIPAddress = ip.String()
+					}
+				}
+				h.add(e)
+			}()
+			next.ServeHTTP(hw, r)
+		})
+	}
+}
+
+// HARHandler downloads the captured exchanges as a HAR file; DELETE clears
+// them.
+func HARHandler(h *harLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			h.reset()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.Header().Set("Allow", "GET, HEAD, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", `attachment; filename="httpcodes.har"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(map[string]interface{}{
+			"log": map[string]interface{}{
+				"version": "1.2",
+				"creator": map[string]string{"name": "httpcodes", "version": "1.0"},
+				"entries": h.snapshot(),
+			},
+		})
+	}
+}
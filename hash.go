@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HashHandler hashes the request body with {algo}, one of md5, sha1, sha256
+// or sha512, and responds with the digest. The code query parameter sets the
+// status.
+func HashHandler(w http.ResponseWriter, r *http.Request) {
+	algo := mux.Vars(r)["algo"]
+	newHash, ok := hashes[algo]
+	if !ok {
+		badRequest(w, errors.Errorf("Unsupported algorithm %q, expected md5, sha1, sha256 or sha512", algo))
+		return
+	}
+	code := http.StatusOK
+	if v := r.URL.Query().Get("code"); v != "" {
+		var err error
+		if code, err = checkCode(r, v); err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+
+	h := newHash()
+	n, err := io.Copy(h, r.Body)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to read body"))
+		return
+	}
+	sum := h.Sum(nil)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"algorithm": algo,
+		"size":      n,
+		"hex":       hex.EncodeToString(sum),
+		"base64":    base64.StdEncoding.EncodeToString(sum),
+	})
+}
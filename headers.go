@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("h")
+}
+
+// validHeaderName reports whether name is a valid header field name.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// extraHeaders adds a response header for every h query parameter, given
+// as Name:value. Repeating a name sends it more than once.
+func extraHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()["h"]
+		if len(params) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		extra := http.Header{}
+		for _, h := range params {
+			name, value, _ := strings.Cut(h, ":")
+			if !validHeaderName(name) || strings.ContainsAny(value, "\r\n") {
+				badRequest(w, errors.Errorf("Invalid header %q, expected Name:value", h))
+				return
+			}
+			extra.Add(name, strings.TrimSpace(value))
+		}
+
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, hook: func(int) {
+			for name, values := range extra {
+				for _, v := range values {
+					w.Header().Add(name, v)
+				}
+			}
+		}}, r)
+	})
+}
+
+// ResponseHeadersHandler sets a response header for every query parameter
+// but the global ones such as delay, and echoes the resulting headers as
+// JSON.
+func ResponseHeadersHandler(w http.ResponseWriter, r *http.Request) {
+	for name, values := range r.URL.Query() {
+		if globalParams[strings.ToLower(name)] {
+			continue
+		}
+		if !validHeaderName(name) {
+			badRequest(w, errors.Errorf("Invalid header name %q", name))
+			return
+		}
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n") {
+				badRequest(w, errors.Errorf("Invalid value for header %s", name))
+				return
+			}
+			w.Header().Add(name, v)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	body, _ := json.MarshalIndent(w.Header(), "", "  ")
+	w.Write(body)
+}
+
+// maxHugeHeaders caps the number of headers HugeHeadersHandler emits.
+const maxHugeHeaders = 10000
+
+// HugeHeadersHandler emits count headers of size bytes each, to probe
+// header limits in clients and intermediaries.
+func HugeHeadersHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := intParam(r, "count", 100)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process count"))
+		return
+	}
+	if count > maxHugeHeaders {
+		badRequest(w, errors.Errorf("count must be at most %d", maxHugeHeaders))
+		return
+	}
+
+	size, err := sizeParam(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process size"))
+		return
+	}
+	if size < 0 {
+		size = 64
+	}
+	if int64(count)*size > maxBytes {
+		badRequest(w, errors.Errorf("Headers must total at most %d bytes", maxBytes))
+		return
+	}
+
+	code := http.StatusOK
+	if v := r.URL.Query().Get("code"); v != "" {
+		if code, err = checkCode(r, v); err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+
+	value := string(filler(size))
+	for i := 0; i < count; i++ {
+		w.Header().Set(fmt.Sprintf("X-Huge-%04d", i), value)
+	}
+	w.WriteHeader(code)
+}
+
+// HeadersHandler echoes the request header as JSON. With raw=true the fields
+// are listed as name and value pairs in the order and spelling they were
+// sent, duplicates included.
+func HeadersHandler(w http.ResponseWriter, r *http.Request) {
+	raw, err := boolParam(r, "raw")
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process raw"))
+		return
+	}
+
+	var body interface{}
+	if raw {
+		fields, ok := rawHeaders(r)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, errors.New("Raw headers are not available for this connection"))
+			return
+		}
+		body = map[string]interface{}{"headers": fields}
+	} else {
+		headers := map[string]string{"Host": r.Host}
+		for name, values := range r.Header {
+			headers[name] = strings.Join(values, ", ")
+		}
+		body = map[string]interface{}{"headers": headers}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(body)
+}
+
+// UserAgentHandler echoes the request's User-Agent.
+func UserAgentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string]string{"user-agent": r.UserAgent()})
+}
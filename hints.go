@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EarlyHintsHandler sends 103 Early Hints carrying a Link header for each
+// links query parameter before the final response. A bare URL is sent as a
+// preload; anything else is used as the Link value verbatim. The count
+// query parameter repeats the 103 response, up to maxInformational times.
+func EarlyHintsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := parseCode(r); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	count, err := intParam(r, "count", 1)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if count > maxInformational {
+		badRequest(w, errors.Errorf("At most %d informational responses can be sent", maxInformational))
+		return
+	}
+
+	for _, link := range r.URL.Query()["links"] {
+		for _, l := range strings.Split(link, ",") {
+			if l = strings.TrimSpace(l); l == "" {
+				continue
+			}
+			if !strings.HasPrefix(l, "<") {
+				l = "<" + l + ">; rel=preload"
+			}
+			w.Header().Add("Link", l)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+	StatusHandler(w, r)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// hookWriter calls hook with the final status code just before the response
+// header is written, giving middleware a chance to adjust headers that depend
+// on the code.
+type hookWriter struct {
+	http.ResponseWriter
+	hook        func(code int)
+	wroteHeader bool
+}
+
+func (hw *hookWriter) WriteHeader(code int) {
+	if !hw.wroteHeader && (code < 100 || code >= 200) {
+		hw.wroteHeader = true
+		hw.hook(code)
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *hookWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *hookWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (hw *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (hw *hookWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxIdempotencyKey caps how long an Idempotency-Key may be.
+const maxIdempotencyKey = 255
+
+type storedResponse struct {
+	Fingerprint []byte `json:"fingerprint"`
+	Code        int    `json:"code"`
+	Body        []byte `json:"body"`
+}
+
+// idempotencyKeys remembers the response given for each Idempotency-Key in
+// the state store until it expires.
+type idempotencyKeys struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newIdempotencyKeys(store Store, ttl time.Duration) *idempotencyKeys {
+	return &idempotencyKeys{store: store, ttl: ttl}
+}
+
+// remember returns the response already stored for key, or else stores and
+// returns s. It reports whether the response was already stored.
+func (k *idempotencyKeys) remember(key string, s storedResponse) (storedResponse, bool, error) {
+	v, _ := json.Marshal(s)
+	for {
+		stored, ok, err := k.store.Get("idempotency:" + key)
+		if err != nil {
+			return s, false, err
+		}
+		if ok {
+			var existing storedResponse
+			err := json.Unmarshal(stored, &existing)
+			return existing, true, err
+		}
+		// Another request may store a response first, or the one read may
+		// expire, so go around until one or the other sticks.
+		if swapped, err := k.store.CompareAndSwap("idempotency:"+key, nil, v, k.ttl); err != nil || swapped {
+			return s, false, err
+		}
+	}
+}
+
+// IdempotencyHandler simulates a Stripe-style idempotent create. The first
+// request with an Idempotency-Key responds 201 (or the code query parameter)
+// with a new object, and repeats of it get the same stored response with
+// Idempotent-Replayed set. Reusing a key for a different method, path or body
+// is a 409.
+func IdempotencyHandler(k *idempotencyKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+			w.Header().Set("Allow", "POST, PUT, PATCH")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || len(key) > maxIdempotencyKey {
+			badRequest(w, errors.Errorf("Idempotency-Key must be set and at most %d characters", maxIdempotencyKey))
+			return
+		}
+		code := http.StatusCreated
+		if v := r.URL.Query().Get("code"); v != "" {
+			var err error
+			if code, err = checkCode(r, v); err != nil {
+				badRequest(w, err)
+				return
+			}
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, errors.Wrap(err, "Unable to read body"))
+			return
+		}
+		fingerprint := sha256.Sum256(bytes.Join([][]byte{[]byte(r.Method), []byte(r.URL.Path), body}, []byte{0}))
+
+		now := time.Now()
+		object := map[string]interface{}{
+			"id":              newUUID(),
+			"idempotency_key": key,
+			"created":         now.UTC(),
+			"status":          code,
+		}
+		if json.Valid(body) {
+			object["request"] = json.RawMessage(body)
+		} else if len(body) > 0 {
+			object["request"] = string(body)
+		}
+		encoded, _ := json.Marshal(object)
+		created := storedResponse{Fingerprint: fingerprint[:], Code: code, Body: append(encoded, '\n')}
+		s, replayed, err := k.remember(key, created)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		if !bytes.Equal(s.Fingerprint, fingerprint[:]) {
+			writeError(w, http.StatusConflict, errors.Errorf("Idempotency-Key %q was already used with a different request", key))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Idempotent-Replayed", strconv.FormatBool(replayed))
+		w.WriteHeader(s.Code)
+		w.Write(s.Body)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	imageWidth  = 200
+	imageHeight = 100
+	// glyphScale is the size in pixels of one cell of the digit font.
+	glyphScale = 8
+)
+
+// digitGlyphs is a 5x7 bitmap font for the digits 0-9.
+var digitGlyphs = [10][7]string{
+	{".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	{"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	{".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	{"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	{"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	{"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	{"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	{"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	{".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	{".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+}
+
+// statusColor picks a color for the class of the status code.
+func statusColor(code int) color.RGBA {
+	switch {
+	case code >= 500:
+		return color.RGBA{0xe0, 0x5d, 0x44, 0xff}
+	case code >= 400:
+		return color.RGBA{0xfe, 0x7d, 0x37, 0xff}
+	case code >= 300:
+		return color.RGBA{0x00, 0x7e, 0xc6, 0xff}
+	case code >= 200:
+		return color.RGBA{0x44, 0xcc, 0x11, 0xff}
+	default:
+		return color.RGBA{0x9f, 0x9f, 0x9f, 0xff}
+	}
+}
+
+// renderStatus draws the status code in white on a background colored by
+// its class.
+func renderStatus(code int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{statusColor(code)}, image.Point{}, draw.Src)
+
+	digits := strconv.Itoa(code)
+	textWidth := len(digits)*6*glyphScale - glyphScale
+	x0 := (imageWidth - textWidth) / 2
+	y0 := (imageHeight - 7*glyphScale) / 2
+	for i, d := range digits {
+		if d < '0' || d > '9' {
+			continue
+		}
+		for row, line := range digitGlyphs[d-'0'] {
+			for col, px := range line {
+				if px != '#' {
+					continue
+				}
+				x := x0 + (i*6+col)*glyphScale
+				y := y0 + row*glyphScale
+				draw.Draw(img, image.Rect(x, y, x+glyphScale, y+glyphScale), image.White, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
+
+// ImageHandler renders the status code as a PNG, JPEG or SVG image.
+func ImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	switch vars["ext"] {
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+	case "jpg", "jpeg":
+		w.Header().Set("Content-Type", "image/jpeg")
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+	default:
+		badRequest(w, errors.Errorf("Unsupported image format %q", vars["ext"]))
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+
+	switch vars["ext"] {
+	case "png":
+		png.Encode(w, renderStatus(code))
+	case "jpg", "jpeg":
+		jpeg.Encode(w, renderStatus(code), nil)
+	case "svg":
+		c := statusColor(code)
+		fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %[1]d %[2]d">`+
+			`<rect width="100%%" height="100%%" fill="#%02x%02x%02x"/>`+
+			`<text x="50%%" y="50%%" dominant-baseline="central" text-anchor="middle" `+
+			`font-family="DejaVu Sans,Verdana,sans-serif" font-size="56" fill="#fff">%d</text></svg>`,
+			imageWidth, imageHeight, c.R, c.G, c.B, code)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxInformational caps the number of interim responses sent per request.
+const maxInformational = 1000
+
+// InformationalHandler sends the 1xx codes listed in the codes query
+// parameter (default 100), repeated repeat times and spaced by interval,
+// before the final response. 101 is refused since it ends the exchange.
+func InformationalHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := parseCode(r); err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	list := r.URL.Query().Get("codes")
+	if list == "" {
+		list = strconv.Itoa(http.StatusContinue)
+	}
+	var codes []int
+	for _, v := range strings.Split(list, ",") {
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 100 || code > 199 || code == http.StatusSwitchingProtocols {
+			badRequest(w, errors.Errorf("Invalid informational code %q", v))
+			return
+		}
+		codes = append(codes, code)
+	}
+
+	repeat, err := intParam(r, "repeat", 1)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process repeat"))
+		return
+	}
+	if repeat > maxInformational/len(codes) {
+		badRequest(w, errors.Errorf("At most %d informational responses can be sent", maxInformational))
+		return
+	}
+
+	interval, err := durationParam(r, "interval", 0)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process interval"))
+		return
+	}
+
+	if n := time.Duration(repeat * len(codes)); n > 0 && interval > time.Duration(math.MaxInt64)/n {
+		badRequest(w, errors.Errorf("Interval %s is too long", interval))
+		return
+	}
+
+	extendDeadline(r, interval*time.Duration(repeat*len(codes)))
+	for i := 0; i < repeat; i++ {
+		for _, code := range codes {
+			w.WriteHeader(code)
+			if interval > 0 {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+		}
+	}
+	StatusHandler(w, r)
+}
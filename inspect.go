@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type bodyInspection struct {
+	Size                int                    `json:"size"`
+	SHA256              string                 `json:"sha256"`
+	DeclaredLength      *int64                 `json:"declared_content_length"`
+	LengthMatches       bool                   `json:"content_length_matches"`
+	TransferEncoding    []string               `json:"transfer_encoding,omitempty"`
+	DeclaredContentType string                 `json:"declared_content_type,omitempty"`
+	DetectedContentType string                 `json:"detected_content_type"`
+	ContentEncoding     string                 `json:"content_encoding,omitempty"`
+	ReadError           string                 `json:"read_error,omitempty"`
+	JSON                interface{}            `json:"json,omitempty"`
+	Form                map[string]interface{} `json:"form,omitempty"`
+	Files               map[string]interface{} `json:"files,omitempty"`
+}
+
+// InspectHandler reports on the request body: its size and SHA-256, how
+// its length compares with the declared Content-Length, its declared and
+// sniffed content types and, for JSON and form bodies, what it decodes to.
+func InspectHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		w.Header().Set("Allow", "POST, PUT, PATCH")
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if len(body) > maxBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("Body must not exceed %d bytes", maxBytes))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	report := bodyInspection{
+		Size:                len(body),
+		SHA256:              hex.EncodeToString(sum[:]),
+		TransferEncoding:    r.TransferEncoding,
+		DeclaredContentType: r.Header.Get("Content-Type"),
+		DetectedContentType: http.DetectContentType(body),
+		ContentEncoding:     r.Header.Get("Content-Encoding"),
+	}
+	if v := r.Header.Get("Content-Length"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			report.DeclaredLength = &n
+			report.LengthMatches = n == int64(len(body))
+		}
+	} else {
+		report.LengthMatches = true
+	}
+	if err != nil {
+		report.ReadError = err.Error()
+	}
+	report.JSON, report.Form, report.Files = decodeBody(body, report.DeclaredContentType)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(report)
+}
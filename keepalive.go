@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("connection", "keepalive-max")
+}
+
+// countRequests is a ConnContext function that gives each connection a
+// counter of the requests served on it.
+func countRequests(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey, new(int64))
+}
+
+// keepAlive controls connection reuse. The connection query parameter sets
+// Connection to close or keep-alive for this response; keepalive-max closes
+// the connection once it has served that many requests.
+func keepAlive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var served int64
+		if n, ok := r.Context().Value(connRequestsKey).(*int64); ok {
+			served = atomic.AddInt64(n, 1)
+		}
+
+		q := r.URL.Query()
+		switch v := q.Get("connection"); v {
+		case "":
+		case "close", "keep-alive":
+			w.Header().Set("Connection", v)
+		default:
+			badRequest(w, errors.Errorf("Invalid connection %q, expected close or keep-alive", v))
+			return
+		}
+		if v := q.Get("keepalive-max"); v != "" {
+			max, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || max < 1 {
+				badRequest(w, errors.Errorf("Invalid keepalive-max %q", v))
+				return
+			}
+			if served >= max {
+				w.Header().Set("Connection", "close")
+			} else {
+				w.Header().Set("Connection", "keep-alive")
+				w.Header().Set("Keep-Alive", "max="+strconv.FormatInt(max-served, 10))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
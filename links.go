@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const maxPages = 10000
+
+type pageLinks struct {
+	Page  int               `json:"page"`
+	Pages int               `json:"pages"`
+	Links map[string]string `json:"links"`
+}
+
+// LinksHandler serves page {page} of {n} with RFC 8288 Link headers pointing
+// at the first, previous, next and last pages. The body lists the same links
+// as HTML, or as JSON when the client prefers it.
+func LinksHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	n, err := strconv.Atoi(vars["n"])
+	if err != nil || n < 1 || n > maxPages {
+		badRequest(w, errors.Errorf("Invalid page count %q, must be between 1 and %d", vars["n"], maxPages))
+		return
+	}
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil || page < 1 || page > n {
+		badRequest(w, errors.Errorf("Invalid page %q, must be between 1 and %d", vars["page"], n))
+		return
+	}
+
+	href := func(p int) string {
+		u := *r.URL
+		u.Path = fmt.Sprintf("/links/%d/%d", n, p)
+		return u.RequestURI()
+	}
+	body := pageLinks{Page: page, Pages: n, Links: map[string]string{
+		"first": href(1),
+		"last":  href(n),
+	}}
+	if page > 1 {
+		body.Links["prev"] = href(page - 1)
+	}
+	if page < n {
+		body.Links["next"] = href(page + 1)
+	}
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if link, ok := body.Links[rel]; ok {
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=%q", link, rel))
+		}
+	}
+
+	accept := r.Header.Values("Accept")
+	if acceptQuality(accept, "application/json") > acceptQuality(accept, "text/html") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	var list strings.Builder
+	for p := 1; p <= n; p++ {
+		if p == page {
+			fmt.Fprintf(&list, "%d ", p)
+			continue
+		}
+		fmt.Fprintf(&list, "<a href=\"%s\">%d</a> ", html.EscapeString(href(p)), p)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprintf(w, "<html><head><title>Page %d of %d</title></head><body>%s</body></html>\n", page, n, list.String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// slowListener hands a fraction of accepted connections to the server only
+// after acceptDelay, and makes a fraction of them wait stallDelay before
+// their first write, which for TLS connections is the ServerHello.
+// Connections that are not delayed are not held up by those that are.
+type slowListener struct {
+	net.Listener
+	acceptDelay    time.Duration
+	acceptFraction float64
+	stallDelay     time.Duration
+	stallFraction  float64
+
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	conns  chan net.Conn
+	err    chan error
+	closed chan struct{}
+	start  sync.Once
+	stop   sync.Once
+}
+
+func newSlowListener(l net.Listener, acceptDelay time.Duration, acceptFraction float64, stallDelay time.Duration, stallFraction float64) *slowListener {
+	return &slowListener{
+		Listener:       l,
+		acceptDelay:    acceptDelay,
+		acceptFraction: acceptFraction,
+		stallDelay:     stallDelay,
+		stallFraction:  stallFraction,
+		rnd:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		conns:          make(chan net.Conn),
+		err:            make(chan error, 1),
+		closed:         make(chan struct{}),
+	}
+}
+
+func (l *slowListener) chosen(fraction float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rnd.Float64() < fraction
+}
+
+// run accepts connections until the listener is closed or fails for good.
+// Temporary errors, such as running out of file descriptors, are retried
+// with a backoff, as net/http does.
+func (l *slowListener) run() {
+	var backoff time.Duration
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if backoff == 0 {
+					backoff = 5 * time.Millisecond
+				} else if backoff *= 2; backoff > time.Second {
+					backoff = time.Second
+				}
+				select {
+				case <-time.After(backoff):
+					continue
+				case <-l.closed:
+				}
+			}
+			l.err <- err
+			return
+		}
+		backoff = 0
+		if l.stallDelay > 0 && l.chosen(l.stallFraction) {
+			c = &stallConn{Conn: c, delay: l.stallDelay}
+		}
+		if l.acceptDelay > 0 && l.chosen(l.acceptFraction) {
+			go func() {
+				time.Sleep(l.acceptDelay)
+				l.handOff(c)
+			}()
+			continue
+		}
+		l.handOff(c)
+	}
+}
+
+// handOff passes c to Accept, or closes it if the listener has been closed.
+func (l *slowListener) handOff(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		c.Close()
+	}
+}
+
+func (l *slowListener) Accept() (net.Conn, error) {
+	l.start.Do(func() { go l.run() })
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.err:
+		// Keep the error for any later Accept calls.
+		l.err <- err
+		return nil, err
+	}
+}
+
+func (l *slowListener) Close() error {
+	l.stop.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// stallConn waits before its first write.
+type stallConn struct {
+	net.Conn
+	delay time.Duration
+	once  sync.Once
+}
+
+// NetConn returns the wrapped connection, so that it can be reset.
+func (c *stallConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *stallConn) Write(b []byte) (int, error) {
+	c.once.Do(func() { time.Sleep(c.delay) })
+	return c.Conn.Write(b)
+}
@@ -2,37 +2,132 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	_ "embed"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"regexp"
 	"sync/atomic"
 	"time"
 
 	"github.com/caarlos0/env/v7"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
 )
 
 type config struct {
-	Port int `env:"PORT" envDefault:"3000"`
+	Port                  int    `env:"PORT" envDefault:"3000"`
+	TemplateDir           string `env:"TEMPLATE_DIR"`
+	AllowNonstandardCodes bool   `env:"ALLOW_NONSTANDARD_CODES"`
+	// MethodRestrictions maps path prefixes to the methods they accept, as
+	// in "/json/=GET,HEAD;/plain/=GET".
+	MethodRestrictions string        `env:"METHOD_RESTRICTIONS"`
+	SecureHeaders      bool          `env:"SECURE_HEADERS"`
+	ReadTimeout        time.Duration `env:"READ_TIMEOUT" envDefault:"5s"`
+	WriteTimeout       time.Duration `env:"WRITE_TIMEOUT" envDefault:"10s"`
+	// MaxTimeout is the ceiling for per-request timeout overrides and for
+	// extensions made by slow endpoints such as ?delay= and /drip.
+	MaxTimeout time.Duration `env:"MAX_TIMEOUT" envDefault:"5m"`
+	// MaxDelay caps the delay a client can ask for.
+	MaxDelay time.Duration `env:"MAX_DELAY" envDefault:"30s"`
+	// MaxHang caps how long /blackhole and ?hang= hold a connection open.
+	MaxHang time.Duration `env:"MAX_HANG" envDefault:"5m"`
+	// TLSCertFile and TLSKeyFile serve HTTPS instead of HTTP when both set.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+	// AcceptDelay holds back AcceptDelayFraction of new connections before
+	// the server starts reading from them; TLSStall makes TLSStallFraction
+	// of TLS handshakes wait before the ServerHello.
+	AcceptDelay         time.Duration `env:"ACCEPT_DELAY"`
+	AcceptDelayFraction float64       `env:"ACCEPT_DELAY_FRACTION" envDefault:"1"`
+	TLSStall            time.Duration `env:"TLS_STALL"`
+	TLSStallFraction    float64       `env:"TLS_STALL_FRACTION" envDefault:"1"`
+	// AdminToken is the bearer token for the /admin API, which is disabled
+	// without one.
+	AdminToken string `env:"ADMIN_TOKEN"`
+	// OutageWindows schedules daily or weekly outages in UTC, as in
+	// "02:00-02:15=503;Sun 23:30-00:30=502".
+	OutageWindows string `env:"OUTAGE_WINDOWS"`
+	// TrustedProxies lists the addresses and CIDR ranges of proxies whose
+	// Forwarded, X-Forwarded-For and PROXY protocol headers are believed.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+	// MaxUploadSize caps the size of a whole /upload request, as in "5mb".
+	MaxUploadSize string `env:"MAX_UPLOAD_SIZE" envDefault:"10mb"`
+	// HAREntries is how many recent exchanges /admin/har keeps.
+	HAREntries int `env:"HAR_ENTRIES" envDefault:"100"`
+	// BinTTL is how long a /bin/new bin keeps capturing requests.
+	BinTTL time.Duration `env:"BIN_TTL" envDefault:"1h"`
+	// IdempotencyTTL is how long /idempotent replays the response for a key.
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	// StateBackend keeps the state of sequences, bins, idempotency keys,
+	// async jobs, /conditional resources and the /store sandbox in memory,
+	// or in Redis at RedisURL so that replicas share it.
+	StateBackend string `env:"STATE_BACKEND" envDefault:"memory"`
+	RedisURL     string `env:"REDIS_URL" envDefault:"redis://localhost:6379/0"`
+	// ScenarioFile is a YAML or JSON file of named scenarios served under
+	// /scenario/{name}.
+	ScenarioFile string `env:"SCENARIO_FILE"`
+	// StoreTTL is the longest an object may live in the /store sandbox.
+	StoreTTL time.Duration `env:"STORE_TTL" envDefault:"1h"`
+	// StubsFile saves the /admin/stubs stubs across restarts.
+	StubsFile string `env:"STUBS_FILE"`
+	// ProxyUpstream is where unknown paths are proxied, recording each
+	// response as a stub that answers the same request from then on.
+	ProxyUpstream string `env:"PROXY_UPSTREAM"`
+	// OpenAPISpec is an OpenAPI 3 file or URL whose operations are mocked
+	// with their documented responses, ahead of the built-in routes.
+	OpenAPISpec string `env:"OPENAPI_SPEC"`
+	// WebhookAllowedHosts lists the hosts /webhook may deliver to, as in
+	// "hooks.example.com,*.test.internal". Webhooks are disabled without it.
+	WebhookAllowedHosts string `env:"WEBHOOK_ALLOWED_HOSTS"`
+	// CounterTTL is how long /cycle, /sequence and /scenario progress is kept
+	// after its last request.
+	CounterTTL time.Duration `env:"COUNTER_TTL" envDefault:"1h"`
+	// ConditionalTTL is how long a /conditional resource is kept after it
+	// was last written.
+	ConditionalTTL time.Duration `env:"CONDITIONAL_TTL" envDefault:"1h"`
+	// JobTTL is how long an /async job can be polled.
+	JobTTL time.Duration `env:"JOB_TTL" envDefault:"1h"`
+	// SessionTTL is how long a session, and the state kept for it, lasts.
+	SessionTTL time.Duration `env:"SESSION_TTL" envDefault:"1h"`
 }
 
 type key int
 
 const (
-	requestIDKey key = 0
+	requestIDKey      key = 0
+	strictCodesKey    key = 1
+	deadlinesKey      key = 2
+	connRequestsKey   key = 3
+	headerRecorderKey key = 4
+	proxiedURLKey     key = 5
+	sessionKey        key = 6
 )
 
+// maxBodySize caps how much of a request body is read by handlers that echo it.
+const maxBodySize = 1 << 20
+
 var (
 	healthy int32
 	//go:embed index.html
 	indexHTML string
+	//go:embed status.html
+	statusHTML     string
+	statusTemplate = template.Must(template.New("status").Parse(statusHTML))
+	// jsonpCallback restricts JSONP callbacks to dotted JavaScript identifiers.
+	jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
 )
 
 func main() {
@@ -44,12 +139,178 @@ func main() {
 		logger.Fatal(err)
 	}
 
+	tmpls, err := loadTemplates(cfg.TemplateDir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	windows, err := parseOutageWindows(cfg.OutageWindows)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	trusted, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	maxUpload, err := parseSize(cfg.MaxUploadSize)
+	if err != nil {
+		logger.Fatal(errors.Wrap(err, "Unable to process MAX_UPLOAD_SIZE"))
+	}
+
+	if cfg.HAREntries < 0 {
+		logger.Fatal(errors.New("HAR_ENTRIES must not be negative"))
+	}
+
+	scenarios, err := loadScenarios(cfg.ScenarioFile, !cfg.AllowNonstandardCodes, cfg.MaxDelay)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	mocks, err := loadOpenAPI(cfg.OpenAPISpec)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(mocks) > 0 {
+		logger.Println("Mocking", len(mocks), "operations from", cfg.OpenAPISpec)
+	}
+
+	state, err := newStore(cfg.StateBackend, cfg.RedisURL)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	chaos := newChaos()
+	stubRules := newStubs(state, !cfg.AllowNonstandardCodes, cfg.MaxDelay, cfg.StubsFile)
+	if err := stubRules.restore(); err != nil {
+		logger.Fatal(err)
+	}
+	har := newHARLog(cfg.HAREntries)
+	requests := newTail()
+	captures := newBins(state, cfg.BinTTL)
+	asyncJobs := newJobs(state, cfg.JobTTL)
+	idempotency := newIdempotencyKeys(state, cfg.IdempotencyTTL)
+	resources := newVersions(state, cfg.ConditionalTTL)
+	objects := newObjectStore(state, cfg.StoreTTL)
+	sessionStates := newSessions(state, cfg.SessionTTL)
+
 	r := mux.NewRouter()
+	r.Use(headerControls)
+	r.Use(timeoutOverride)
+	r.Use(outages(windows))
+	r.Use(chaosInjection(chaos))
+	r.Use(delay(cfg.MaxDelay))
+	r.Use(connectionReset)
+	r.Use(hang(cfg.MaxHang))
+	r.Use(failures)
+	r.Use(prefer(asyncJobs, cfg.MaxDelay))
+	r.Use(cors)
+	r.Use(templating(tmpls))
+	r.Use(vary)
+	r.Use(extraHeaders)
+	r.Use(secureHeaders(cfg.SecureHeaders))
+	r.Use(deprecation)
+	r.Use(authChallenge)
+	r.Use(rateLimitHeaders)
+	r.Use(retryAfter)
+	r.Use(methodRestrictions(parseMethodRules(cfg.MethodRestrictions)))
+	mockOpenAPI(r, mocks)
 	r.HandleFunc("/", getRoot)
 	r.HandleFunc("/json/{code}", JSONHandler)
 	r.HandleFunc("/plain/{code}", PlainHandler)
+	r.HandleFunc("/xml/{code}", XMLHandler)
+	r.HandleFunc("/html/{code}", HTMLHandler)
+	r.HandleFunc("/yaml/{code}", YAMLHandler)
+	r.HandleFunc("/msgpack/{code}", MsgpackHandler)
+	r.HandleFunc("/cbor/{code}", CBORHandler)
+	r.HandleFunc("/proto/{code}", ProtoHandler)
+	r.HandleFunc("/problem/{code}", ProblemHandler)
+	r.HandleFunc("/ndjson/{code}", NDJSONHandler(cfg.MaxDelay))
+	r.HandleFunc("/bytes/{code}/{n}", BytesHandler)
+	r.HandleFunc("/image/{code:[0-9]+}.{ext}", ImageHandler)
+	r.HandleFunc("/badge/{code}", BadgeHandler)
+	r.HandleFunc("/graphql/{code}", GraphQLHandler)
+	r.HandleFunc("/multipart/{code}", MultipartHandler)
+	r.HandleFunc("/download/{code}", DownloadHandler)
+	r.HandleFunc("/base64/{value}", Base64Handler)
+	r.HandleFunc("/unicode/{code}", UnicodeHandler)
+	r.HandleFunc("/status/{code}", StatusHandler)
+	r.HandleFunc("/random", RandomHandler)
+	r.HandleFunc("/random/{class:[1-5]xx}", RandomHandler)
+	r.HandleFunc("/random/string", RandomStringHandler)
+	r.HandleFunc("/uuid", UUIDHandler)
+	r.HandleFunc("/now", NowHandler)
+	r.HandleFunc("/cycle/{codes}", CycleHandler(newCounters(state, "cycle:", cfg.CounterTTL)))
+	r.HandleFunc("/sequence/{steps}", SequenceHandler(newCounters(state, "sequence:", cfg.CounterTTL)))
+	r.HandleFunc("/redirect/{n}", RedirectHandler)
+	r.HandleFunc("/links/{n}/{page}", LinksHandler)
+	r.HandleFunc("/cookies", CookiesHandler)
+	r.HandleFunc("/cookies/set", SetCookiesHandler)
+	r.HandleFunc("/cookies/delete", DeleteCookiesHandler)
+	r.HandleFunc("/redirect-to", RedirectToHandler)
+	r.HandleFunc("/cache", CacheControlHandler)
+	r.HandleFunc("/cache/{code}", CacheHandler)
+	r.HandleFunc("/range/{bytes}", RangeHandler)
+	r.HandleFunc("/continue/{code}", ContinueHandler(cfg.MaxDelay))
+	r.HandleFunc("/early-hints/{code}", EarlyHintsHandler)
+	r.HandleFunc("/informational/{code}", InformationalHandler)
+	r.HandleFunc("/multistatus", MultistatusHandler)
+	r.HandleFunc("/reset", ResetHandler)
+	r.HandleFunc("/malformed", MalformedHandler)
+	r.HandleFunc("/blackhole", BlackholeHandler(cfg.MaxHang))
+	r.HandleFunc("/drip/{code}", DripHandler(cfg.MaxDelay))
+	r.HandleFunc("/trailers/{code}", TrailersHandler)
+	r.HandleFunc("/response-headers", ResponseHeadersHandler)
+	r.HandleFunc("/ip", IPHandler(trusted))
+	r.HandleFunc("/user-agent", UserAgentHandler)
+	r.HandleFunc("/tls", TLSHandler)
+	r.HandleFunc("/headers", HeadersHandler)
+	r.HandleFunc("/headers/huge", HugeHeadersHandler)
+	r.HandleFunc("/inspect", InspectHandler)
+	r.HandleFunc("/hash/{algo}", HashHandler)
+	r.HandleFunc("/echo", EchoHandler(cfg.MaxDelay))
+	r.HandleFunc("/upload", UploadHandler(maxUpload))
+	r.HandleFunc("/get", MethodHandler(http.MethodGet))
+	r.HandleFunc("/post", MethodHandler(http.MethodPost))
+	r.HandleFunc("/put", MethodHandler(http.MethodPut))
+	r.HandleFunc("/patch", MethodHandler(http.MethodPatch))
+	r.HandleFunc("/delete", MethodHandler(http.MethodDelete))
+	r.HandleFunc("/async/jobs/{id}", AsyncJobHandler(asyncJobs))
+	r.HandleFunc("/async/{code}", AsyncHandler(asyncJobs))
+	r.HandleFunc("/scenario/{name}", ScenarioHandler(scenarios, newCounters(state, "scenario:", cfg.CounterTTL)))
+	r.HandleFunc("/store/{bucket}/{key}", StoreHandler(objects))
+	r.HandleFunc("/conditional/{name}", ConditionalHandler(resources))
+	r.HandleFunc("/idempotent", IdempotencyHandler(idempotency))
+	r.HandleFunc("/webhook", WebhookHandler(cfg.MaxDelay, parseWebhookHosts(cfg.WebhookAllowedHosts), logger))
+	r.HandleFunc("/bin/new", NewBinHandler(captures))
+	r.HandleFunc("/bin/{token}", BinHandler(captures))
+	r.HandleFunc("/bin/{token}/requests", BinRequestsHandler(captures))
+	r.HandleFunc("/session", SessionHandler(sessionStates))
+	r.HandleFunc("/session/reset", SessionResetHandler(sessionStates))
+	r.HandleFunc("/anything", AnythingHandler)
+	r.HandleFunc("/anything/{path:.*}", AnythingHandler)
 	r.HandleFunc("/healthz", healthz)
 
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(adminAuth(cfg.AdminToken))
+	admin.HandleFunc("/chaos", ChaosHandler(chaos, cfg.MaxDelay))
+	admin.HandleFunc("/har", HARHandler(har))
+	admin.HandleFunc("/tail", TailHandler(requests))
+	admin.HandleFunc("/stubs", StubsHandler(stubRules))
+	admin.HandleFunc("/stubs/{id}", StubHandler(stubRules))
+	admin.HandleFunc("/scenarios", ScenariosHandler(stubRules))
+	admin.HandleFunc("/scenarios/{name}/reset", ScenarioResetHandler(stubRules))
+	admin.HandleFunc("/reset", StateResetHandler(state, stubRules, sessionStates))
+
+	if cfg.ProxyUpstream != "" {
+		proxy, err := recordingProxy(cfg.ProxyUpstream, stubRules, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		r.NotFoundHandler = proxy
+	}
+
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
@@ -57,11 +318,18 @@ func main() {
 	listenAddr := fmt.Sprintf(":%d", cfg.Port)
 	server := &http.Server{
 		Addr:         listenAddr,
-		Handler:      handlers.RecoveryHandler()(tracing(nextRequestID)(logging(logger)(r))),
+		Handler:      handlers.RecoveryHandler()(resetHeaderRecorder(tracing(nextRequestID)(logging(logger)(tailing(requests)(harCapture(har)(statusCodes(!cfg.AllowNonstandardCodes)(keepAlive(throttle(truncation(contentLengthMismatch(chunkedMalformation(headerConflicts(compression(sessionScoping(sessionStates)(stubbing(stubRules)(r)))))))))))))))),
 		ErrorLog:     logger,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
 		IdleTimeout:  15 * time.Second,
+		// Ask for, but don't verify, client certificates so /tls can show them.
+		TLSConfig: &tls.Config{ClientAuth: tls.RequestClientCert},
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			ctx = connDeadlines(cfg.ReadTimeout, cfg.WriteTimeout, cfg.MaxTimeout)(ctx, c)
+			ctx = countRequests(ctx, c)
+			return recordHeaders(ctx, c)
+		},
 	}
 
 	done := make(chan bool)
@@ -85,7 +353,28 @@ func main() {
 
 	logger.Println("Server is ready to handle requests at", listenAddr)
 	atomic.StoreInt32(&healthy, 1)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		logger.Fatalf("Could not listen on %s: %v\n", listenAddr, err)
+	}
+	useTLS := cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+	if cfg.AcceptDelay > 0 || (useTLS && cfg.TLSStall > 0) {
+		stall := cfg.TLSStall
+		if !useTLS {
+			stall = 0
+		}
+		ln = newSlowListener(ln, cfg.AcceptDelay, cfg.AcceptDelayFraction, stall, cfg.TLSStallFraction)
+	}
+	if len(trusted) > 0 {
+		ln = proxyProtocolListener{Listener: ln, trusted: trusted, timeout: cfg.ReadTimeout}
+	}
+	ln = recordingListener{ln}
+	if useTLS {
+		err = server.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
 		logger.Fatalf("Could not listen on %s: %v\n", listenAddr, err)
 	}
 
@@ -131,40 +420,286 @@ func tracing(nextRequestID func() string) func(http.Handler) http.Handler {
 }
 
 func JSONHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	callback := r.URL.Query().Get("callback")
+	if callback != "" && !jsonpCallback.MatchString(callback) {
+		badRequest(w, errors.Errorf("Invalid callback %q", callback))
+		return
+	}
+
+	mode := r.URL.Query().Get("body")
+	if mode == "none" || mode == "empty" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		writeEmpty(w, mode, code)
+		return
+	}
+
+	body, err := jsonBody(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process body"))
+		return
+	}
+
+	size, err := sizeParam(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process size"))
+		return
+	}
+	if size >= 0 {
+		if body, err = padJSON(body, size); err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process size"))
+			return
+		}
+	}
+
+	if callback != "" {
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	switch {
+	case code == http.StatusNoContent:
+		return
+	case callback != "":
+		fmt.Fprintf(w, "/**/%s(%s);", callback, body)
+	default:
+		w.Write(body)
+	}
+}
+
+// jsonBody returns the JSON document to respond with: the body query
+// parameter if set, otherwise the request body, otherwise an empty object.
+func jsonBody(r *http.Request) ([]byte, error) {
+	body := []byte(r.URL.Query().Get("body"))
+	if len(body) == 0 && r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(body) == 0 {
+		return []byte("{}"), nil
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("body is not valid JSON")
+	}
+	return body, nil
+}
+
+func PlainHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	size, err := sizeParam(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process size"))
+		return
+	}
+
+	charset, err := charsetParam(r)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process charset"))
+		return
+	}
+
+	mode := r.URL.Query().Get("body")
+	switch mode {
+	case "", "none", "empty", "null":
+	default:
+		badRequest(w, errors.Errorf("Invalid body %q, expected none, empty or null", mode))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset="+charset.name)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if mode == "none" || mode == "empty" {
+		writeEmpty(w, mode, code)
+		return
+	}
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+	body := charset.writer(w)
+	defer body.Close()
+	switch {
+	case size >= 0:
+		body.Write(filler(size))
+	default:
+		io.WriteString(body, mode)
+	}
+}
+
+// writeEmpty writes a response without a body. The "none" mode omits
+// Content-Length entirely (the response is sent chunked), while "empty"
+// declares Content-Length: 0.
+func writeEmpty(w http.ResponseWriter, mode string, code int) {
+	switch mode {
+	case "none":
+		w.Header().Del("Content-Length")
+		w.WriteHeader(code)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	case "empty":
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(code)
+	}
+}
 
-	code, err := strconv.ParseInt(vars["code"], 10, 0)
+func XMLHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
 	if err != nil {
-		panic(errors.Wrap(err, "Unable to process code"))
+		badRequest(w, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(int(code))
+	w.WriteHeader(code)
 	switch code {
 	case http.StatusNoContent:
 		return
 	default:
-		io.WriteString(w, "{}")
+		fmt.Fprintf(w, "%s<response code=\"%d\"/>\n", xml.Header, code)
 	}
 }
 
-func PlainHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+func HTMLHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
 
-	code, err := strconv.ParseInt(vars["code"], 10, 0)
+	charset, err := charsetParam(r)
 	if err != nil {
-		panic(errors.Wrap(err, "Unable to process code"))
+		badRequest(w, errors.Wrap(err, "Unable to process charset"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset="+charset.name)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	switch code {
+	case http.StatusNoContent:
+		return
+	default:
+		body := charset.writer(w)
+		defer body.Close()
+		statusTemplate.Execute(body, struct {
+			Code    int
+			Reason  string
+			Charset string
+		}{code, http.StatusText(code), charset.name})
+	}
+}
+
+func YAMLHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	switch code {
+	case http.StatusNoContent:
+		return
+	default:
+		yaml.NewEncoder(w).Encode(struct {
+			Code    int    `yaml:"code"`
+			Message string `yaml:"message"`
+		}{code, http.StatusText(code)})
+	}
+}
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func ProblemHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	switch code {
+	case http.StatusNoContent:
+		return
+	default:
+		json.NewEncoder(w).Encode(problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(code),
+			Status:   code,
+			Detail:   fmt.Sprintf("The server responded with status %d.", code),
+			Instance: r.URL.Path,
+		})
+	}
+}
+
+// binaryStatus is the map encoded by the binary format handlers.
+type binaryStatus struct {
+	Code   int    `msgpack:"code" cbor:"code"`
+	Reason string `msgpack:"reason" cbor:"reason"`
+}
+
+func MsgpackHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/msgpack")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	switch code {
+	case http.StatusNoContent:
+		return
+	default:
+		msgpack.NewEncoder(w).Encode(binaryStatus{code, http.StatusText(code)})
+	}
+}
+
+func CBORHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Type", "application/cbor")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(int(code))
+	w.WriteHeader(code)
 	switch code {
 	case http.StatusNoContent:
 		return
 	default:
-		io.WriteString(w, "")
+		cbor.NewEncoder(w).Encode(binaryStatus{code, http.StatusText(code)})
 	}
 }
 
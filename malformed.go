@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// malformedResponses write deliberately broken HTTP/1.1, by mode.
+var malformedResponses = map[string]func() []byte{
+	// A status line with a non-numeric code and no reason separator.
+	"bad-status-line": func() []byte {
+		return []byte("HTTP/1.1 2OO\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\nOK\n")
+	},
+	// Random bytes where the status line should be.
+	"binary-garbage": func() []byte {
+		b := make([]byte, 512)
+		rand.Read(b)
+		return b
+	},
+	// A status line and headers, then the connection closes before the blank
+	// line that ends the header block.
+	"headers-only": func() []byte {
+		return []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n")
+	},
+	// An HTTP/0.9 style response: a bare body with no status line or headers.
+	"http09": func() []byte {
+		return []byte("<html><body>200 OK</body></html>\n")
+	},
+	// Header lines without colons and with bare LF line endings.
+	"bad-headers": func() []byte {
+		return []byte("HTTP/1.1 200 OK\nContent-Type text/plain\nX-Broken\r\n: no-name\r\n\r\nOK\n")
+	},
+	// A status line claiming a protocol version that does not exist.
+	"bad-version": func() []byte {
+		return []byte("HTTP/7.3 200 OK\r\nContent-Length: 3\r\n\r\nOK\n")
+	},
+}
+
+// MalformedHandler hijacks the connection and writes the invalid response
+// selected by the mode query parameter, then closes the connection.
+func MalformedHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "bad-status-line"
+	}
+	response, ok := malformedResponses[mode]
+	if !ok {
+		modes := make([]string, 0, len(malformedResponses))
+		for m := range malformedResponses {
+			modes = append(modes, m)
+		}
+		sort.Strings(modes)
+		badRequest(w, errors.Errorf("Unsupported mode %q, expected one of %s", mode, strings.Join(modes, ", ")))
+		return
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("response does not support hijacking"))
+		return
+	}
+	conn, buf, err := h.Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hijack connection"))
+		return
+	}
+	defer conn.Close()
+	buf.Write(response())
+	buf.Flush()
+}
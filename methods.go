@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("allow")
+}
+
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// methodRestrictions limits the methods a route accepts. The allow query
+// parameter (such as allow=GET,POST) takes precedence over rules, which map
+// path prefixes to comma-separated methods; the longest matching prefix
+// wins. Requests with other methods get a 405, and any 405 response carries
+// an Allow header listing the permitted methods.
+func methodRestrictions(rules map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed := allowedMethods(r, rules)
+			allow := strings.Join(allowed, ", ")
+			if allowed != nil && !containsFold(allowed, r.Method) {
+				w.Header().Set("Allow", allow)
+				writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+				return
+			}
+
+			next.ServeHTTP(&hookWriter{ResponseWriter: w, hook: func(code int) {
+				if code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "" {
+					return
+				}
+				if allowed == nil {
+					// The request's own method was refused, so offer the rest.
+					for _, m := range standardMethods {
+						if m != r.Method {
+							allowed = append(allowed, m)
+						}
+					}
+					allow = strings.Join(allowed, ", ")
+				}
+				w.Header().Set("Allow", allow)
+			}}, r)
+		})
+	}
+}
+
+// parseMethodRules parses rules such as "/json/=GET,HEAD;/plain/=GET".
+func parseMethodRules(v string) map[string]string {
+	rules := map[string]string{}
+	for _, rule := range strings.Split(v, ";") {
+		if prefix, methods, ok := strings.Cut(rule, "="); ok {
+			rules[strings.TrimSpace(prefix)] = methods
+		}
+	}
+	return rules
+}
+
+// allowedMethods returns the methods permitted for r, or nil if the route is
+// unrestricted.
+func allowedMethods(r *http.Request, rules map[string]string) []string {
+	list := r.URL.Query().Get("allow")
+	if list == "" {
+		prefix := ""
+		for p, methods := range rules {
+			if strings.HasPrefix(r.URL.Path, p) && len(p) > len(prefix) {
+				prefix, list = p, methods
+			}
+		}
+	}
+	if list == "" {
+		return nil
+	}
+	var methods []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"github.com/pkg/errors"
+)
+
+// maxParts caps the number of parts a multipart response may contain.
+const maxParts = 100
+
+// partBodies are cycled through to give each part a different content type.
+var partBodies = []struct {
+	contentType string
+	body        func(code, part int) string
+}{
+	{"text/plain; charset=utf-8", func(code, part int) string {
+		return fmt.Sprintf("part %d: %d %s", part, code, http.StatusText(code))
+	}},
+	{"application/json", func(code, part int) string {
+		return fmt.Sprintf(`{"part":%d,"code":%d}`, part, code)
+	}},
+	{"application/xml", func(code, part int) string {
+		return fmt.Sprintf(`<response part="%d" code="%d"/>`, part, code)
+	}},
+	{"text/html; charset=utf-8", func(code, part int) string {
+		return fmt.Sprintf("<p>part %d: %d</p>", part, code)
+	}},
+	{"application/octet-stream", func(code, part int) string {
+		return string([]byte{byte(part), byte(code >> 8), byte(code)})
+	}},
+}
+
+// MultipartHandler writes a multipart/mixed body with the requested number
+// of parts.
+func MultipartHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	parts, err := intParam(r, "parts", 3)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process parts"))
+		return
+	}
+	if parts > maxParts {
+		badRequest(w, errors.Errorf("parts must be at most %d", maxParts))
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+
+	for i := 0; i < parts; i++ {
+		p := partBodies[i%len(partBodies)]
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {p.contentType},
+			"Content-Id":   {fmt.Sprintf("<part%d>", i)},
+		})
+		if err != nil {
+			return
+		}
+		fmt.Fprint(pw, p.body(code, i))
+	}
+	mw.Close()
+}
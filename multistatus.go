@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type multistatus struct {
+	XMLName   xml.Name            `xml:"DAV: multistatus"`
+	Responses []multistatusResult `xml:"response"`
+}
+
+type multistatusResult struct {
+	Href   string `xml:"href"`
+	Status string `xml:"status"`
+}
+
+// MultistatusHandler responds 207 with a WebDAV multistatus body holding a
+// response element for each of the codes query parameter.
+func MultistatusHandler(w http.ResponseWriter, r *http.Request) {
+	list := r.URL.Query().Get("codes")
+	if list == "" {
+		list = "200"
+	}
+
+	var body multistatus
+	for i, v := range strings.Split(list, ",") {
+		code, err := checkCode(r, v)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		body.Responses = append(body.Responses, multistatusResult{
+			Href:   fmt.Sprintf("/multistatus/%d", i),
+			Status: fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(body)
+}
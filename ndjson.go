@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxNDJSONLines caps the lines query parameter.
+const maxNDJSONLines = 10000
+
+// NDJSONHandler streams newline-delimited JSON objects, flushing each line
+// as it is written. The lines are interval milliseconds apart, taking no
+// more than max in total.
+func NDJSONHandler(max time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, err := parseCode(r)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		lines, err := intParam(r, "lines", 10)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process lines"))
+			return
+		}
+		if lines > maxNDJSONLines {
+			badRequest(w, errors.Errorf("Lines must not exceed %d", maxNDJSONLines))
+			return
+		}
+
+		ms, err := intParam(r, "interval", 100)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process interval"))
+			return
+		}
+		if time.Duration(ms) > max/time.Millisecond {
+			badRequest(w, errors.Errorf("Interval must not exceed %s", max))
+			return
+		}
+		interval := time.Duration(ms) * time.Millisecond
+		var total time.Duration
+		if lines > 1 {
+			if interval > max/time.Duration(lines-1) {
+				badRequest(w, errors.Errorf("Lines at interval %s must not take longer than %s", interval, max))
+				return
+			}
+			total = interval * time.Duration(lines-1)
+		}
+
+		extendDeadline(r, total)
+		flusher, _ := w.(http.Flusher)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+
+		enc := json.NewEncoder(w)
+		for i := 0; i < lines; i++ {
+			if i > 0 && !sleep(r, interval) {
+				return
+			}
+			enc.Encode(struct {
+				Line int `json:"line"`
+				Code int `json:"code"`
+			}{i, code})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type offer struct {
+	mediaType string
+	handler   http.HandlerFunc
+}
+
+// offers lists the formats served by StatusHandler. The first entry is also
+// the fallback when nothing in the Accept header matches.
+var offers = []offer{
+	{"text/plain", PlainHandler},
+	{"application/json", JSONHandler},
+	{"application/problem+json", ProblemHandler},
+	{"application/xml", XMLHandler},
+	{"text/xml", XMLHandler},
+	{"text/html", HTMLHandler},
+	{"application/yaml", YAMLHandler},
+	{"application/msgpack", MsgpackHandler},
+	{"application/cbor", CBORHandler},
+	{"application/x-protobuf", ProtoHandler},
+}
+
+// StatusHandler picks a response format based on the Accept header. The
+// code may also be a comma-separated list of codes with optional weights,
+// such as 200:0.9,500:0.1, from which one is picked per request.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	if v := mux.Vars(r)["code"]; strings.ContainsAny(v, ",:") {
+		code, err := pickWeighted(r, v)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		r = mux.SetURLVars(r, map[string]string{"code": code})
+	}
+
+	w.Header().Add("Vary", "Accept")
+	negotiate(r.Header.Values("Accept")).handler(w, r)
+}
+
+// pickWeighted chooses a code from a list like 200:0.9,500:0.05,503:0.05.
+// Codes without a weight count as weight 1.
+func pickWeighted(r *http.Request, list string) (string, error) {
+	var codes []string
+	var weights []float64
+	total := 0.0
+	for _, entry := range strings.Split(list, ",") {
+		code, weight, hasWeight := strings.Cut(entry, ":")
+		w := 1.0
+		if hasWeight {
+			var err error
+			if w, err = strconv.ParseFloat(weight, 64); err != nil || w < 0 {
+				return "", errors.Errorf("Invalid weight %q for code %s", weight, code)
+			}
+		}
+		codes = append(codes, code)
+		weights = append(weights, w)
+		total += w
+	}
+	if total <= 0 {
+		return "", errors.New("Weights must not all be zero")
+	}
+
+	rnd, err := seedParam(r)
+	if err != nil {
+		return "", err
+	}
+	n := rnd.Float64() * total
+	for i, w := range weights {
+		if n < w {
+			return codes[i], nil
+		}
+		n -= w
+	}
+	return codes[len(codes)-1], nil
+}
+
+func negotiate(accept []string) offer {
+	best, bestQ := offers[0], 0.0
+	for _, o := range offers {
+		if q := acceptQuality(accept, o.mediaType); q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value the Accept header grants mediaType,
+// using the most specific matching media range.
+func acceptQuality(accept []string, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s := -1
+			switch {
+			case rng == mediaType:
+				s = 2
+			case rng == typ+"/*":
+				s = 1
+			case rng == "*/*":
+				s = 0
+			}
+			if s <= specificity {
+				continue
+			}
+			specificity = s
+			q = 1
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth bounds how many $refs are followed to reach a definition.
+const maxRefDepth = 8
+
+// serverVariable matches a variable such as {port} in a server URL.
+var serverVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// mockResponse is a documented response of an operation, ready to send.
+type mockResponse struct {
+	code        int
+	contentType string
+	headers     map[string]string
+	body        []byte
+}
+
+// mockOperation is one method on one path of an OpenAPI spec.
+type mockOperation struct {
+	method    string
+	path      string
+	responses map[string]mockResponse
+	// preferred is the response served without ?code=, the lowest 2xx one
+	// if there is any.
+	preferred string
+}
+
+// openAPISpec resolves local $refs while walking a decoded spec.
+type openAPISpec map[string]interface{}
+
+// loadOpenAPI reads an OpenAPI 3 spec in YAML or JSON from a file or an
+// http(s) URL, and mocks each of its operations. An empty source means no
+// operations.
+func loadOpenAPI(source string) ([]*mockOperation, error) {
+	if source == "" {
+		return nil, nil
+	}
+	data, err := readSpec(source)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse OpenAPI spec %s", source)
+	}
+	root, _ := jsonCompatible(doc).(map[string]interface{})
+	spec := openAPISpec(root)
+	if version, _ := spec["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, errors.Errorf("OpenAPI spec %s is not OpenAPI 3", source)
+	}
+
+	// Operations are served under the path of the first server, as in
+	// https://api.example.com/v1, with its variables at their defaults.
+	prefix := ""
+	if servers, _ := spec["servers"].([]interface{}); len(servers) > 0 {
+		server, _ := spec.resolve(servers[0]).(map[string]interface{})
+		if raw, _ := server["url"].(string); raw != "" {
+			variables, _ := server["variables"].(map[string]interface{})
+			raw = serverVariable.ReplaceAllStringFunc(raw, func(v string) string {
+				variable, _ := variables[v[1:len(v)-1]].(map[string]interface{})
+				def, _ := variable["default"].(string)
+				return def
+			})
+			u, err := url.Parse(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid server URL %q", raw)
+			}
+			prefix = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+
+	paths, _ := spec["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ops []*mockOperation
+	for _, name := range names {
+		item, _ := spec.resolve(paths[name]).(map[string]interface{})
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			op, err := spec.operation(strings.ToUpper(method), prefix+name, operation)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid operation %s %s", strings.ToUpper(method), name)
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+func readSpec(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		return data, errors.Wrap(err, "Unable to read OpenAPI spec")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to fetch OpenAPI spec")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Unable to fetch OpenAPI spec, got %s", res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, 10*maxBodySize))
+	return data, errors.Wrap(err, "Unable to fetch OpenAPI spec")
+}
+
+// resolve follows v's $ref, if it has one, within the spec.
+func (spec openAPISpec) resolve(v interface{}) interface{} {
+	for depth := 0; depth < maxRefDepth; depth++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return v
+		}
+		var target interface{} = map[string]interface{}(spec)
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			node, _ := target.(map[string]interface{})
+			target = node[part]
+		}
+		v = target
+	}
+	return nil
+}
+
+func (spec openAPISpec) operation(method, path string, operation map[string]interface{}) (*mockOperation, error) {
+	op := &mockOperation{method: method, path: path, responses: map[string]mockResponse{}}
+	responses, _ := spec.resolve(operation["responses"]).(map[string]interface{})
+	best := 0
+	for key, v := range responses {
+		key = strings.ToUpper(key)
+		code := http.StatusOK
+		if key != "DEFAULT" {
+			n, err := strconv.Atoi(strings.ReplaceAll(key, "XX", "00"))
+			if err != nil || n < 100 || n > 599 {
+				return nil, errors.Errorf("Invalid response code %q", key)
+			}
+			code = n
+		}
+		response, _ := spec.resolve(v).(map[string]interface{})
+		op.responses[key] = spec.response(code, response)
+
+		rank := code
+		if key == "DEFAULT" {
+			rank = 1000
+		} else if code >= 200 && code < 300 {
+			rank -= 1000
+		}
+		if op.preferred == "" || rank < best {
+			op.preferred, best = key, rank
+		}
+	}
+	if op.preferred == "" {
+		op.responses["DEFAULT"] = mockResponse{code: http.StatusOK}
+		op.preferred = "DEFAULT"
+	}
+	return op, nil
+}
+
+// response picks the JSON media type if there is one, and otherwise the
+// first, and renders its example.
+func (spec openAPISpec) response(code int, response map[string]interface{}) mockResponse {
+	mr := mockResponse{code: code, headers: map[string]string{}}
+	headers, _ := response["headers"].(map[string]interface{})
+	for name, v := range headers {
+		header, _ := spec.resolve(v).(map[string]interface{})
+		if !validHeaderName(name) || strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+		if value, ok := spec.example(header); ok {
+			if _, isObject := value.(map[string]interface{}); !isObject {
+				mr.headers[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	content, _ := response["content"].(map[string]interface{})
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	sort.SliceStable(types, func(i, j int) bool {
+		return strings.Contains(types[i], "json") && !strings.Contains(types[j], "json")
+	})
+	if len(types) == 0 {
+		return mr
+	}
+	mr.contentType = types[0]
+	media, _ := spec.resolve(content[mr.contentType]).(map[string]interface{})
+	value, ok := spec.example(media)
+	if !ok {
+		return mr
+	}
+	if s, isString := value.(string); isString && !strings.Contains(mr.contentType, "json") {
+		mr.body = []byte(s)
+		return mr
+	}
+	mr.body, _ = json.MarshalIndent(value, "", "  ")
+	mr.body = append(mr.body, '\n')
+	return mr
+}
+
+// example returns the example of a media type, header or schema, making one
+// up from the schema when none is given.
+func (spec openAPISpec) example(m map[string]interface{}) (interface{}, bool) {
+	if v, ok := m["example"]; ok {
+		return v, true
+	}
+	if examples, ok := m["examples"].(map[string]interface{}); ok && len(examples) > 0 {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		example, _ := spec.resolve(examples[names[0]]).(map[string]interface{})
+		if v, ok := example["value"]; ok {
+			return v, true
+		}
+	}
+	if _, ok := spec.resolve(m["schema"]).(map[string]interface{}); !ok {
+		return nil, false
+	}
+	return spec.generate(m["schema"], nil), true
+}
+
+// generate makes up a value conforming to the schema v. refs are the
+// schemas being generated already, which are left out rather than recursed
+// into.
+func (spec openAPISpec) generate(v interface{}, refs []string) interface{} {
+	if ref := schemaRef(v); ref != "" {
+		if containsString(refs, ref) {
+			return nil
+		}
+		refs = append(refs[:len(refs):len(refs)], ref)
+	}
+	schema, _ := spec.resolve(v).(map[string]interface{})
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if choices, ok := schema[key].([]interface{}); ok && len(choices) > 0 {
+			return spec.generate(choices[0], refs)
+		}
+	}
+	if parts, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, part := range parts {
+			if obj, ok := spec.generate(part, refs).(map[string]interface{}); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	kind, _ := schema["type"].(string)
+	if kind == "" {
+		if _, ok := schema["properties"]; ok {
+			kind = "object"
+		} else if _, ok := schema["items"]; ok {
+			kind = "array"
+		}
+	}
+	switch kind {
+	case "object":
+		obj := map[string]interface{}{}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for name, p := range properties {
+			value := spec.generate(p, refs)
+			if value == nil && containsString(refs, schemaRef(p)) && !containsValue(required, name) {
+				continue
+			}
+			obj[name] = value
+		}
+		return obj
+	case "array":
+		items := schema["items"]
+		if containsString(refs, schemaRef(items)) {
+			return []interface{}{}
+		}
+		n := 1
+		if min, ok := schema["minItems"].(int); ok && min > n {
+			n = min
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = spec.generate(items, refs)
+		}
+		return list
+	case "integer", "number":
+		n := 0.0
+		switch min := schema["minimum"].(type) {
+		case int:
+			n = float64(min)
+		case float64:
+			n = min
+		}
+		if kind == "integer" {
+			return int(n)
+		}
+		return n
+	case "boolean":
+		return true
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "date":
+			return "2006-01-02"
+		case "email":
+			return "user@example.com"
+		case "uri", "url":
+			return "https://example.com/"
+		case "uuid":
+			return "00000000-0000-4000-8000-000000000000"
+		}
+		return "string"
+	}
+	return nil
+}
+
+func schemaRef(v interface{}) string {
+	m, _ := v.(map[string]interface{})
+	ref, _ := m["$ref"].(string)
+	return ref
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonCompatible converts what YAML decodes into what encoding/json would
+// have, so that response codes and other non-string keys become strings.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = jsonCompatible(item)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = jsonCompatible(item)
+		}
+		return list
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// MockHandler answers an OpenAPI operation with its preferred documented
+// response, or the one the code query parameter asks for.
+func MockHandler(op *mockOperation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := op.preferred
+		if v := r.URL.Query().Get("code"); v != "" {
+			code, err := checkCode(r, v)
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			key = strconv.Itoa(code)
+			if _, ok := op.responses[key]; !ok {
+				key = fmt.Sprintf("%dXX", code/100)
+			}
+			if _, ok := op.responses[key]; !ok {
+				key = "DEFAULT"
+			}
+			if _, ok := op.responses[key]; !ok {
+				badRequest(w, errors.Errorf("Code %d is not documented for %s %s", code, op.method, op.path))
+				return
+			}
+			if key != strconv.Itoa(code) {
+				mr := op.responses[key]
+				mr.code = code
+				mr.write(w, r)
+				return
+			}
+		}
+		op.responses[key].write(w, r)
+	}
+}
+
+func (mr mockResponse) write(w http.ResponseWriter, r *http.Request) {
+	for k, v := range mr.headers {
+		w.Header().Set(k, v)
+	}
+	if mr.body != nil {
+		w.Header().Set("Content-Type", mr.contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.WriteHeader(mr.code)
+	if mr.body != nil && r.Method != http.MethodHead {
+		w.Write(mr.body)
+	}
+}
+
+// mockOpenAPI routes each operation to its mock, GET ones answering HEAD
+// too where the spec does not say otherwise.
+func mockOpenAPI(r *mux.Router, ops []*mockOperation) {
+	heads := map[string]bool{}
+	for _, op := range ops {
+		if op.method == http.MethodHead {
+			heads[op.path] = true
+		}
+	}
+	for _, op := range ops {
+		methods := []string{op.method}
+		if op.method == http.MethodGet && !heads[op.path] {
+			methods = append(methods, http.MethodHead)
+		}
+		r.HandleFunc(op.path, MockHandler(op)).Methods(methods...)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// outageWindow is a recurring period, in UTC, during which every request is
+// answered with code.
+type outageWindow struct {
+	weekday    time.Weekday
+	anyDay     bool
+	start, end time.Duration // since midnight
+	code       int
+}
+
+// parseOutageWindows parses windows such as "02:00-02:15=503;Sun
+// 23:30-00:30=502". Each window optionally starts with a weekday and may run
+// past midnight; the code defaults to 503.
+func parseOutageWindows(v string) ([]outageWindow, error) {
+	var windows []outageWindow
+	for _, entry := range strings.Split(v, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		o := outageWindow{anyDay: true, code: http.StatusServiceUnavailable}
+		span, code, hasCode := strings.Cut(entry, "=")
+		if hasCode {
+			n, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil || n < 100 || n > 599 {
+				return nil, errors.Errorf("Invalid code in outage window %q", entry)
+			}
+			o.code = n
+		}
+		if day, rest, ok := strings.Cut(strings.TrimSpace(span), " "); ok {
+			weekday, ok := parseWeekday(day)
+			if !ok {
+				return nil, errors.Errorf("Invalid weekday in outage window %q", entry)
+			}
+			o.weekday, o.anyDay, span = weekday, false, rest
+		}
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, errors.Errorf("Invalid outage window %q, expected HH:MM-HH:MM", entry)
+		}
+		var err error
+		if o.start, err = clockTime(from); err != nil {
+			return nil, errors.Wrapf(err, "Invalid outage window %q", entry)
+		}
+		if o.end, err = clockTime(to); err != nil {
+			return nil, errors.Wrapf(err, "Invalid outage window %q", entry)
+		}
+		windows = append(windows, o)
+	}
+	return windows, nil
+}
+
+// parseWeekday parses a weekday name such as Sun or Sunday.
+func parseWeekday(v string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(v, d.String()) || strings.EqualFold(v, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// clockTime parses HH:MM as time since midnight.
+func clockTime(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// active reports whether now falls in the window and, if so, when the
+// window ends.
+func (o outageWindow) active(now time.Time) (bool, time.Time) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// A window that runs past midnight may have started the day before.
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !o.anyDay && day.Weekday() != o.weekday {
+			continue
+		}
+		start, end := day.Add(o.start), day.Add(o.end)
+		if o.end <= o.start {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !now.Before(start) && now.Before(end) {
+			return true, end
+		}
+	}
+	return false, time.Time{}
+}
+
+// outages answers every request outside the admin API with the window's
+// code while an outage window is active, announcing its end in
+// Retry-After.
+func outages(windows []outageWindow) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAdmin(r) {
+				for _, o := range windows {
+					if ok, end := o.active(time.Now()); ok {
+						seconds := int(time.Until(end).Seconds()) + 1
+						w.Header().Set("Retry-After", strconv.Itoa(seconds))
+						StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(o.code)}))
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
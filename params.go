@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// globalParams are the query parameters the middlewares in front of every
+// route act on, and code, which handlers must not take for their own data.
+// Each file registers its own with globalParam.
+var globalParams = map[string]bool{}
+
+// globalParam adds names to globalParams.
+func globalParam(names ...string) {
+	for _, name := range names {
+		globalParams[name] = true
+	}
+}
+
+// intParam parses the named query parameter as a non-negative integer,
+// returning def when it is absent.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.Errorf("%s must not be negative", name)
+	}
+	return n, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseSize parses a byte size such as "512", "64kb" or "1mb". Units are
+// binary multiples and case-insensitive.
+func parseSize(v string) (int64, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	scale := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSuffix(v, u.suffix), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid size")
+	}
+	if n < 0 || n > maxBytes/scale {
+		return 0, errors.Errorf("size must be between 0 and %d bytes", maxBytes)
+	}
+	return n * scale, nil
+}
+
+// sizeParam parses the size query parameter, returning -1 when absent.
+func sizeParam(r *http.Request) (int64, error) {
+	v := r.URL.Query().Get("size")
+	if v == "" {
+		return -1, nil
+	}
+	return parseSize(v)
+}
+
+// filler returns n bytes of repeating printable text.
+func filler(n int64) []byte {
+	const pattern = "0123456789abcdefghijklmnopqrstuvwxyz"
+	return bytes.Repeat([]byte(pattern), int(n)/len(pattern)+1)[:n]
+}
+
+// padJSON adds a padding member to the JSON object body so the encoded
+// document is exactly size bytes long.
+func padJSON(body []byte, size int64) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' {
+		return nil, errors.New("only JSON objects can be padded")
+	}
+	prefix := append([]byte{}, body[:len(body)-1]...)
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		prefix = append(prefix, ',')
+	}
+	prefix = append(prefix, `"padding":"`...)
+	n := size - int64(len(prefix)) - int64(len(`"}`))
+	if n < 0 {
+		return nil, errors.Errorf("size must be at least %d bytes", size-n)
+	}
+	return append(append(prefix, filler(n)...), `"}`...), nil
+}
+
+// boolParam parses the named query parameter as a boolean, treating an
+// absent parameter as false.
+func boolParam(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// durationParam parses the named query parameter as a duration such as
+// "1500ms" or "2s". Bare numbers are taken as milliseconds. def is returned
+// when the parameter is absent.
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return parseDuration(v)
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(v); err == nil {
+		v = strconv.Itoa(ms) + "ms"
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("duration must not be negative")
+	}
+	return d, nil
+}
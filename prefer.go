@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// parsePrefer returns the preferences of the Prefer headers in r by
+// lowercased name, ignoring their parameters. The first of a repeated
+// preference wins, as RFC 7240 asks.
+func parsePrefer(r *http.Request) map[string]string {
+	prefs := map[string]string{}
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			pref, _, _ = strings.Cut(pref, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := prefs[name]; !ok {
+				prefs[name] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return prefs
+}
+
+// prefer honors the Prefer header on every handler: code=N responds with N
+// instead of running the handler, and respond-async answers 202 with a
+// Location to an async job that finishes with the preferred code, or 200.
+// With respond-async, wait=N (no more than max) is how many seconds the
+// client will wait for the handler's own response: the handler runs, and
+// only if it hasn't answered in time does the 202 come instead. The
+// preferences acted on are listed in Preference-Applied.
+func prefer(j *jobs, max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Prefer") == "" || isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Prefer")
+			prefs := parsePrefer(r)
+
+			var applied []string
+			code, hasCode := http.StatusOK, false
+			if v, ok := prefs["code"]; ok {
+				var err error
+				if code, err = checkCode(r, v); err != nil {
+					badRequest(w, errors.Wrap(err, "Unable to process Prefer code"))
+					return
+				}
+				hasCode = true
+				applied = append(applied, "code="+v)
+			}
+			wait, hasWait := time.Duration(0), false
+			if v, ok := prefs["wait"]; ok {
+				seconds, err := strconv.Atoi(v)
+				if err != nil || seconds < 0 {
+					badRequest(w, errors.Errorf("Invalid Prefer wait %q, expected seconds", v))
+					return
+				}
+				wait, hasWait = time.Duration(seconds)*time.Second, true
+				if wait > max {
+					badRequest(w, errors.Errorf("Prefer wait must not exceed %s", max))
+					return
+				}
+			}
+
+			if _, ok := prefs["respond-async"]; ok {
+				if hasWait && !hasCode {
+					extendDeadline(r, wait)
+					if waitFor(next, w, r, wait, "wait="+prefs["wait"]) {
+						return
+					}
+					applied = append(applied, "wait="+prefs["wait"])
+				}
+				id, err := j.add(code, 0)
+				if err != nil {
+					stateError(w, err)
+					return
+				}
+				location := "/async/jobs/" + id
+				w.Header().Set("Preference-Applied", strings.Join(append(applied, "respond-async"), ", "))
+				w.Header().Set("Location", location)
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "pending", "location": location})
+				return
+			}
+			if len(applied) > 0 {
+				w.Header().Set("Preference-Applied", strings.Join(applied, ", "))
+			}
+			if hasCode {
+				StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(code)}))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// waitFor runs next with its response held back, and sends that response
+// with applied in Preference-Applied if next returns within d. Otherwise it
+// reports false, having cancelled next and discarded its response, and the
+// caller answers instead. next is never left running after waitFor returns.
+func waitFor(next http.Handler, w http.ResponseWriter, r *http.Request, d time.Duration, applied string) bool {
+	held := &heldResponse{header: w.Header().Clone()}
+	ctx, cancel := context.WithCancel(r.Context())
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		next.ServeHTTP(held, r.WithContext(ctx))
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case p := <-done:
+		cancel()
+		if p != nil {
+			// Let the server recover from it as from any other handler.
+			panic(p)
+		}
+		held.send(w, applied)
+		return true
+	case <-t.C:
+		cancel()
+		<-done
+		return false
+	}
+}
+
+// heldResponse keeps a whole response, with its own headers, so that it can
+// be sent or thrown away once the handler is done. Informational responses
+// are dropped.
+type heldResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (h *heldResponse) Header() http.Header {
+	return h.header
+}
+
+func (h *heldResponse) WriteHeader(code int) {
+	if code >= 200 && h.code == 0 {
+		h.code = code
+	}
+}
+
+func (h *heldResponse) Write(b []byte) (int, error) {
+	if h.code == 0 {
+		h.code = http.StatusOK
+	}
+	return h.body.Write(b)
+}
+
+func (h *heldResponse) send(w http.ResponseWriter, applied string) {
+	header := w.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range h.header {
+		header[name] = values
+	}
+	header.Set("Preference-Applied", applied)
+	if h.code == 0 {
+		h.code = http.StatusOK
+	}
+	w.WriteHeader(h.code)
+	w.Write(h.body.Bytes())
+}
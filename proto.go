@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// rpcCodes maps HTTP status codes to their canonical google.rpc.Code, as
+// documented in google/rpc/code.proto.
+var rpcCodes = map[int]code.Code{
+	http.StatusOK:                           code.Code_OK,
+	http.StatusBadRequest:                   code.Code_INVALID_ARGUMENT,
+	http.StatusUnauthorized:                 code.Code_UNAUTHENTICATED,
+	http.StatusForbidden:                    code.Code_PERMISSION_DENIED,
+	http.StatusNotFound:                     code.Code_NOT_FOUND,
+	http.StatusConflict:                     code.Code_ABORTED,
+	http.StatusRequestedRangeNotSatisfiable: code.Code_OUT_OF_RANGE,
+	http.StatusPreconditionFailed:           code.Code_FAILED_PRECONDITION,
+	http.StatusTooManyRequests:              code.Code_RESOURCE_EXHAUSTED,
+	499:                                     code.Code_CANCELLED,
+	http.StatusInternalServerError:          code.Code_INTERNAL,
+	http.StatusNotImplemented:               code.Code_UNIMPLEMENTED,
+	http.StatusServiceUnavailable:           code.Code_UNAVAILABLE,
+	http.StatusGatewayTimeout:               code.Code_DEADLINE_EXCEEDED,
+}
+
+func rpcCode(httpCode int) code.Code {
+	if c, ok := rpcCodes[httpCode]; ok {
+		return c
+	}
+	switch {
+	case httpCode >= 200 && httpCode < 300:
+		return code.Code_OK
+	case httpCode >= 400 && httpCode < 500:
+		return code.Code_FAILED_PRECONDITION
+	default:
+		return code.Code_UNKNOWN
+	}
+}
+
+func ProtoHandler(w http.ResponseWriter, r *http.Request) {
+	httpCode, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	body, err := proto.Marshal(&status.Status{
+		Code:    int32(rpcCode(httpCode)),
+		Message: http.StatusText(httpCode),
+	})
+	if err != nil {
+		panic(errors.Wrap(err, "Unable to encode status"))
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(httpCode)
+	switch httpCode {
+	case http.StatusNoContent:
+		return
+	default:
+		w.Write(body)
+	}
+}
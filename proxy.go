@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseCIDR parses a CIDR range, or a single address as a range of one.
+func parseCIDR(v string) (*net.IPNet, error) {
+	v = strings.TrimSpace(v)
+	if !strings.Contains(v, "/") {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, errors.Errorf("Invalid address %q", v)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(v)
+	if err != nil {
+		return nil, errors.Errorf("Invalid CIDR range %q", v)
+	}
+	return network, nil
+}
+
+// trustedProxies are the peers whose forwarding headers and PROXY protocol
+// headers are believed.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses a comma separated list of addresses and CIDR
+// ranges.
+func parseTrustedProxies(v string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, entry := range strings.Split(v, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		network, err := parseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (t trustedProxies) contains(ip net.IP) bool {
+	for _, network := range t {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostIP returns the IP address in a host:port or bare host string.
+func hostIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// forwardedFor returns the client addresses a request passed through, from
+// the Forwarded header if present and X-Forwarded-For otherwise, nearest
+// hop last.
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+	for _, list := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(list, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// clientIP returns the address of the client behind any trusted proxies:
+// starting from the peer, forwarding headers are followed back for as long
+// as each hop is itself trusted.
+func clientIP(r *http.Request, trusted trustedProxies) string {
+	client := hostIP(r.RemoteAddr)
+	hops := forwardedFor(r)
+	for i := len(hops) - 1; i >= 0 && trusted.contains(client); i-- {
+		ip := hostIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+	}
+	if client == nil {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		return host
+	}
+	return client.String()
+}
+
+// IPHandler responds with the caller's address, looking through trusted
+// proxies.
+func IPHandler(trusted trustedProxies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := clientIP(r, trusted)
+		if accept := r.Header.Values("Accept"); acceptQuality(accept, "text/plain") > acceptQuality(accept, "application/json") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Write([]byte(origin + "\n"))
+			return
+		}
+
+		peer, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(map[string]string{"origin": origin, "peer": peer})
+	}
+}
+
+// proxyProtocolListener reads PROXY protocol headers, version 1 or 2, from
+// connections made by trusted proxies, reporting the original client as the
+// connection's remote address.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted trustedProxies
+	timeout time.Duration
+}
+
+func (l proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted.contains(hostIP(c.RemoteAddr().String())) {
+		return c, nil
+	}
+	return &proxyProtocolConn{Conn: c, r: bufio.NewReader(c), timeout: l.timeout}, nil
+}
+
+// proxyProtocolConn reads the PROXY header, if any, when its remote address
+// is first asked for, which net/http does on the connection's own goroutine.
+type proxyProtocolConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	remote  net.Addr
+}
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.remote = c.Conn.RemoteAddr()
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		if addr, err := c.readHeader(); err == nil && addr != nil {
+			c.remote = addr
+		}
+	})
+}
+
+// readHeader consumes a PROXY header if the connection starts with one and
+// returns the source address it gives.
+func (c *proxyProtocolConn) readHeader() (net.Addr, error) {
+	if b, err := c.r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(b, proxyV2Signature) {
+		return c.readV2()
+	}
+	if b, err := c.r.Peek(6); err != nil || string(b) != "PROXY " {
+		return nil, err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	// PROXY TCP4 <src> <dst> <sport> <dport>, or PROXY UNKNOWN.
+	fields := strings.Fields(line)
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil {
+		return nil, errors.Errorf("Invalid PROXY header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func (c *proxyProtocolConn) readV2() (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	// Only PROXY commands over TCP carry a client address; LOCAL ones come
+	// from the proxy itself.
+	command, family := header[12]&0x0f, header[13]
+	switch {
+	case command != 1:
+		return nil, nil
+	case family == 0x11 && len(body) >= 12:
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case family == 0x21 && len(body) >= 36:
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+// NetConn returns the wrapped connection, so that it can be reset.
+func (c *proxyProtocolConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	return c.r.Read(p)
+}
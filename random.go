@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// knownCodes returns the registered status codes from first to last,
+// inclusive.
+func knownCodes(first, last int) []int {
+	var codes []int
+	for code := first; code <= last; code++ {
+		if http.StatusText(code) != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// seedParam returns a random source seeded by the seed query parameter, or
+// by the current time when it is absent.
+func seedParam(r *http.Request) (*rand.Rand, error) {
+	seed := time.Now().UnixNano()
+	if v := r.URL.Query().Get("seed"); v != "" {
+		var err error
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, errors.Wrap(err, "Unable to process seed")
+		}
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+// RandomHandler responds with a registered status code picked uniformly at
+// random, optionally restricted to a class such as 5xx. The body is
+// negotiated as for /status/{code}.
+func RandomHandler(w http.ResponseWriter, r *http.Request) {
+	first, last := 200, 599
+	if class := mux.Vars(r)["class"]; class != "" {
+		first = int(class[0]-'0') * 100
+		last = first + 99
+	}
+
+	rnd, err := seedParam(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	codes := knownCodes(first, last)
+	code := codes[rnd.Intn(len(codes))]
+	StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(code)}))
+}
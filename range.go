@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// RangeHandler serves a deterministic body of the given size, supporting
+// Range requests with 206, multipart/byteranges and 416 responses.
+func RangeHandler(w http.ResponseWriter, r *http.Request) {
+	size, err := parseSize(mux.Vars(r)["bytes"])
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process bytes"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", strconv.Quote("range-"+strconv.FormatInt(size, 10)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", startTime, bytes.NewReader(filler(size)))
+}
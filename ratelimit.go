@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("ratelimit", "ratelimit-limit", "ratelimit-remaining", "ratelimit-reset")
+}
+
+// rateLimitHeaders adds Retry-After and RateLimit-* headers to 429
+// responses, or to every response when the ratelimit query parameter is
+// true. Values come from the ratelimit-limit (default 100),
+// ratelimit-remaining (default 0) and ratelimit-reset (seconds, default 60)
+// query parameters.
+func rateLimitHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		always, err := boolParam(r, "ratelimit")
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process ratelimit"))
+			return
+		}
+		limit, err := intParam(r, "ratelimit-limit", 100)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process ratelimit-limit"))
+			return
+		}
+		remaining, err := intParam(r, "ratelimit-remaining", 0)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process ratelimit-remaining"))
+			return
+		}
+		reset, err := intParam(r, "ratelimit-reset", 60)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process ratelimit-reset"))
+			return
+		}
+
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, hook: func(code int) {
+			if code != http.StatusTooManyRequests && !always {
+				return
+			}
+			h := w.Header()
+			if code == http.StatusTooManyRequests && h.Get("Retry-After") == "" {
+				h.Set("Retry-After", strconv.Itoa(reset))
+			}
+			h.Set("RateLimit-Limit", strconv.Itoa(limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(reset))
+		}}, r)
+	})
+}
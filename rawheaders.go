@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxRecordedHeader caps how much of a request header block is recorded.
+const maxRecordedHeader = http.DefaultMaxHeaderBytes + 4096
+
+// recordingListener wraps accepted connections in headerRecorders.
+type recordingListener struct {
+	net.Listener
+}
+
+func (l recordingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &headerRecorder{Conn: c}, nil
+}
+
+// headerRecorder keeps a copy of the bytes read from the connection up to
+// the end of the request header block, so the header can be shown exactly
+// as sent. It is reset after each request.
+type headerRecorder struct {
+	net.Conn
+	mu       sync.Mutex
+	buf      []byte
+	complete bool
+}
+
+// NetConn returns the wrapped connection, so that it can be reset.
+func (c *headerRecorder) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *headerRecorder) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	if !c.complete && len(c.buf) < maxRecordedHeader {
+		c.buf = append(c.buf, p[:n]...)
+		c.complete = bytes.Contains(c.buf, []byte("\r\n\r\n"))
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// header returns the recorded header block, or nil if none was recorded.
+func (c *headerRecorder) header() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil
+	}
+	return append([]byte{}, c.buf[:end]...)
+}
+
+func (c *headerRecorder) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf, c.complete = c.buf[:0], false
+}
+
+// recordHeaders is a ConnContext function that makes a connection's
+// headerRecorder available to handlers. TLS connections have none, as the
+// recorder sees only ciphertext.
+func recordHeaders(ctx context.Context, c net.Conn) context.Context {
+	if hr, ok := c.(*headerRecorder); ok {
+		return context.WithValue(ctx, headerRecorderKey, hr)
+	}
+	return ctx
+}
+
+// resetHeaderRecorder starts recording afresh once a request has been
+// handled, ready for the next one on the connection.
+func resetHeaderRecorder(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if hr, ok := r.Context().Value(headerRecorderKey).(*headerRecorder); ok {
+				hr.reset()
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rawHeaders returns the request's header fields as name and value pairs in
+// the order and spelling they were sent, or false if they weren't recorded.
+func rawHeaders(r *http.Request) ([][2]string, bool) {
+	hr, ok := r.Context().Value(headerRecorderKey).(*headerRecorder)
+	if !ok {
+		return nil, false
+	}
+	block := hr.header()
+	if block == nil {
+		return nil, false
+	}
+	lines := strings.Split(string(block), "\n")
+	var fields [][2]string
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		// An obsolete folded line continues the previous field.
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1][1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields = append(fields, [2]string{name, strings.TrimSpace(value)})
+	}
+	return fields, true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// unrecordedHeaders are left out of recorded stubs, as the server sets them
+// itself when it replays the response.
+var unrecordedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// recordingProxy forwards requests to upstream and records each response as
+// an exact-match stub, so that the stubs answer the same requests from then
+// on, even with upstream gone. Bodies that are too large or not UTF-8 are
+// passed through without being recorded.
+func recordingProxy(upstream string, s *stubs, logger *log.Logger) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.Errorf("Invalid PROXY_UPSTREAM %q, expected an absolute http or https URL", upstream)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+		// Let the transport ask for and undo compression, so that bodies
+		// are recorded as they are meant to be read.
+		r.Header.Del("Accept-Encoding")
+	}
+	proxy.ErrorLog = logger
+	proxy.ModifyResponse = func(res *http.Response) error {
+		// The request already has an ID of ours.
+		res.Header.Del("X-Request-Id")
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize+1))
+		if err != nil {
+			return err
+		}
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		if len(body) > maxBodySize || !utf8.Valid(body) {
+			return nil
+		}
+
+		req := res.Request
+		u := req.Context().Value(proxiedURLKey).(*url.URL)
+		st := &stub{
+			ID:      newUUID(),
+			Created: time.Now().UTC(),
+			Request: stubRequest{Method: req.Method, Path: u.Path},
+			Response: scenarioResponse{
+				Status:  res.StatusCode,
+				Headers: map[string]string{},
+			},
+		}
+		text := string(body)
+		st.Response.Body = &text
+		if query := u.Query(); len(query) > 0 {
+			st.Request.Query = map[string]*stringMatcher{}
+			for name, values := range query {
+				v := values[0]
+				st.Request.Query[name] = &stringMatcher{EqualTo: &v}
+			}
+		}
+		for name, values := range res.Header {
+			if !unrecordedHeaders[name] {
+				st.Response.Headers[name] = values[0]
+			}
+		}
+		if err := st.compile(s.strict, s.maxDelay); err != nil {
+			logger.Println("Not recording", req.Method, u.Path+":", err)
+			return nil
+		}
+		if err := s.update(func(list []*stub) []*stub { return append([]*stub{st}, list...) }); err != nil {
+			logger.Println("Unable to record", req.Method, u.Path+":", err)
+			return nil
+		}
+		logger.Println("Recorded", req.Method, u.Path, "as stub", st.ID)
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stubs match the URL as asked for, not as rewritten for upstream.
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxiedURLKey, r.URL)))
+	}), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// redirectCode reads the code query parameter used for redirects, which
+// must be a 3xx code.
+func redirectCode(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("code")
+	if v == "" {
+		return http.StatusFound, nil
+	}
+	code, err := checkCode(r, v)
+	if err != nil {
+		return 0, err
+	}
+	if code < 300 || code > 399 {
+		return 0, errors.Errorf("Redirect code %d is not a 3xx code", code)
+	}
+	return code, nil
+}
+
+// RedirectHandler redirects n times before responding with a 200. Query
+// parameters are carried along the chain.
+func RedirectHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || n < 0 {
+		badRequest(w, errors.Errorf("Invalid redirect count %q", mux.Vars(r)["n"]))
+		return
+	}
+
+	code, err := redirectCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	if n == 0 {
+		StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": strconv.Itoa(http.StatusOK)}))
+		return
+	}
+
+	target := "/redirect/" + strconv.Itoa(n-1)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	location, err := formatLocation(r, target)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
+
+// RedirectToHandler redirects to the url query parameter.
+func RedirectToHandler(w http.ResponseWriter, r *http.Request) {
+	location := r.URL.Query().Get("url")
+	if location == "" {
+		badRequest(w, errors.New("Missing url"))
+		return
+	}
+
+	code, err := redirectCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	if strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+		if location, err = formatLocation(r, location); err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
+
+// formatLocation rewrites the path-absolute target into the form named by
+// the location query parameter:
+//
+//	path        /redirect/1 (the default)
+//	relative    1, resolved against the request path
+//	absolute    http://host/redirect/1
+//	schemeless  //host/redirect/1
+//	other-host  http://other/redirect/1, where other is the host query
+//	            parameter or the request host swapped between localhost
+//	            and 127.0.0.1
+func formatLocation(r *http.Request, target string) (string, error) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	switch r.URL.Query().Get("location") {
+	case "", "path":
+		return target, nil
+	case "relative":
+		return relativePath(r.URL.Path, target), nil
+	case "absolute":
+		return scheme + "://" + r.Host + target, nil
+	case "schemeless":
+		return "//" + r.Host + target, nil
+	case "other-host":
+		return scheme + "://" + otherHost(r) + target, nil
+	default:
+		return "", errors.Errorf("Unsupported location %q", r.URL.Query().Get("location"))
+	}
+}
+
+func otherHost(r *http.Request) string {
+	if host := r.URL.Query().Get("host"); host != "" {
+		return host
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, ""
+	}
+	if host == "localhost" {
+		host = "127.0.0.1"
+	} else {
+		host = "localhost"
+	}
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// relativePath expresses target relative to the directory of from.
+func relativePath(from, target string) string {
+	query := ""
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		target, query = target[:i], target[i:]
+	}
+	fromDir := strings.Split(strings.TrimSuffix(path.Dir(from), "/"), "/")
+	targetParts := strings.Split(target, "/")
+	targetDir := targetParts[:len(targetParts)-1]
+
+	common := 0
+	for common < len(fromDir) && common < len(targetDir) && fromDir[common] == targetDir[common] {
+		common++
+	}
+	rel := strings.Repeat("../", len(fromDir)-common) + strings.Join(targetParts[common:], "/") + query
+	if rel == "" || strings.HasPrefix(rel, "?") {
+		rel = "./" + rel
+	}
+	return rel
+}
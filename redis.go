@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// redisPrefix namespaces keys so that a Redis can be shared.
+	redisPrefix = "httpcodes:"
+	// redisTimeout bounds each command, and redisPoolSize how many idle
+	// connections are kept.
+	redisTimeout  = 5 * time.Second
+	redisPoolSize = 16
+)
+
+// redisCompareAndSwap runs CompareAndSwap atomically. ARGV holds whether old
+// is set, old, whether value is set, value and the TTL in milliseconds.
+const redisCompareAndSwap = `
+local current = redis.call('GET', KEYS[1])
+if ARGV[1] == '0' then
+  if current then return 0 end
+elseif current ~= ARGV[2] then
+  return 0
+end
+if ARGV[3] == '0' then
+  redis.call('DEL', KEYS[1])
+elseif ARGV[5] ~= '0' then
+  redis.call('SET', KEYS[1], ARGV[4], 'PX', ARGV[5])
+else
+  redis.call('SET', KEYS[1], ARGV[4])
+end
+return 1`
+
+// redisIncr increments a counter and sets its TTL in milliseconds from ARGV.
+const redisIncr = `
+local n = redis.call('INCR', KEYS[1])
+if ARGV[1] ~= '0' then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n`
+
+// redisError is an error reply, which leaves the connection usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisStore is a Store in Redis, spoken to over RESP with a small pool of
+// connections.
+type redisStore struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *redisConn
+}
+
+// newRedisStore parses a URL such as redis://:password@host:6379/0. It does
+// not connect until the first command.
+func newRedisStore(rawURL string) (*redisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to process REDIS_URL")
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, errors.Errorf("Invalid REDIS_URL %q, expected redis://[:password@]host[:port][/db]", rawURL)
+	}
+	s := &redisStore{addr: u.Host, idle: make(chan *redisConn, redisPoolSize)}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		s.password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil || s.db < 0 {
+			return nil, errors.Errorf("Invalid database %q in REDIS_URL", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *redisStore) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", s.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	if s.password != "" {
+		if _, err := c.do("AUTH", s.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do runs a command on an idle connection, or a new one if there is none.
+func (s *redisStore) do(args ...string) (interface{}, error) {
+	var c *redisConn
+	select {
+	case c = <-s.idle:
+	default:
+		var err error
+		if c, err = s.dial(); err != nil {
+			return nil, errors.Wrap(err, "Unable to connect to Redis")
+		}
+	}
+	reply, err := c.do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.Close()
+		return nil, errors.Wrap(err, "Unable to talk to Redis")
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read parses one reply: a string, an int64, a []byte or nil for bulk
+// strings, or a []interface{} for arrays.
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.Errorf("Malformed Redis reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	default:
+		return nil, errors.Errorf("Malformed Redis reply %q", line)
+	}
+}
+
+// redisTTL formats ttl for PX and PEXPIRE, rounding up so that short
+// TTLs don't turn into none.
+func redisTTL(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+func redisFlag(b []byte) string {
+	if b == nil {
+		return "0"
+	}
+	return "1"
+}
+
+func (s *redisStore) Get(key string) ([]byte, bool, error) {
+	reply, err := s.do("GET", redisPrefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := reply.([]byte)
+	return v, ok, nil
+}
+
+func (s *redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", redisPrefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", redisTTL(ttl))
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+func (s *redisStore) CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := s.do("EVAL", redisCompareAndSwap, "1", redisPrefix+key,
+		redisFlag(old), string(old), redisFlag(value), string(value), redisTTL(ttl))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (s *redisStore) Delete(key string) (bool, error) {
+	reply, err := s.do("DEL", redisPrefix+key)
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (s *redisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	reply, err := s.do("EVAL", redisIncr, "1", redisPrefix+key, redisTTL(ttl))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, errors.Errorf("Unexpected Redis reply %v", reply)
+	}
+	return n, nil
+}
+
+// redisGlob escapes the characters SCAN MATCH treats specially.
+var redisGlob = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (s *redisStore) DeletePrefix(prefix string) (int, error) {
+	pattern := redisGlob.Replace(redisPrefix+prefix) + "*"
+	cursor, n := "0", 0
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return n, err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return n, errors.Errorf("Unexpected Redis reply %v", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]interface{})
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, k := range keys {
+				if k, ok := k.([]byte); ok {
+					args = append(args, string(k))
+				}
+			}
+			reply, err := s.do(args...)
+			if err != nil {
+				return n, err
+			}
+			deleted, _ := reply.(int64)
+			n += int(deleted)
+		}
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			return n, nil
+		}
+	}
+}
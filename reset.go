@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("reset")
+}
+
+// resetConnection hijacks the connection and closes it with SO_LINGER set to
+// zero, so the client sees a TCP RST rather than an orderly FIN.
+func resetConnection(w http.ResponseWriter) error {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("response does not support hijacking")
+	}
+	conn, _, err := h.Hijack()
+	if err != nil {
+		return err
+	}
+	// Unwrap TLS and the listener wrappers down to the TCP connection.
+	raw := conn
+	for {
+		c, ok := raw.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		raw = c.NetConn()
+	}
+	if tcp, ok := raw.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	return conn.Close()
+}
+
+// ResetHandler answers every request by resetting the connection.
+func ResetHandler(w http.ResponseWriter, r *http.Request) {
+	if err := resetConnection(w); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to reset connection"))
+	}
+}
+
+// connectionReset resets the connection instead of responding when the
+// reset query parameter is true.
+func connectionReset(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reset, err := boolParam(r, "reset")
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process reset"))
+			return
+		}
+		if reset {
+			ResetHandler(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
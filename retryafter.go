@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("retry-after", "retry-after-date")
+}
+
+// retryAfter sets Retry-After on 3xx, 429 and 503 responses. The
+// retry-after query parameter gives it in seconds; retry-after-date gives it
+// as an HTTP-date, either verbatim or as a number of seconds from now.
+func retryAfter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var value string
+		if v := r.URL.Query().Get("retry-after"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds < 0 {
+				badRequest(w, errors.Errorf("Invalid retry-after %q", v))
+				return
+			}
+			value = strconv.Itoa(seconds)
+		}
+		if v := r.URL.Query().Get("retry-after-date"); v != "" {
+			when, err := http.ParseTime(v)
+			if seconds, serr := strconv.Atoi(v); serr == nil {
+				when, err = time.Now().Add(time.Duration(seconds)*time.Second), nil
+			}
+			if err != nil {
+				badRequest(w, errors.Errorf("Invalid retry-after-date %q", v))
+				return
+			}
+			value = when.UTC().Format(http.TimeFormat)
+		}
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, hook: func(code int) {
+			if (code >= 300 && code < 400) || code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", value)
+			}
+		}}, r)
+	})
+}
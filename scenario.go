@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// scenarioResponse is a canned response. Unset fields of a step fall back to
+// those of its scenario.
+type scenarioResponse struct {
+	Status  int               `yaml:"status" json:"status,omitempty"`
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Body    *string           `yaml:"body" json:"body,omitempty"`
+	Delay   string            `yaml:"delay" json:"delay,omitempty"`
+
+	delay time.Duration
+}
+
+type scenarioStep struct {
+	scenarioResponse `yaml:",inline"`
+	// Repeat is how many times the step is served before the next; the last
+	// step repeats forever.
+	Repeat int `yaml:"repeat"`
+}
+
+type scenario struct {
+	scenarioResponse `yaml:",inline"`
+	Steps            []scenarioStep `yaml:"steps"`
+}
+
+func (sr *scenarioResponse) validate(strict bool, maxDelay time.Duration) error {
+	if sr.Status != 0 && strict && (sr.Status < minCode || sr.Status > maxCode) {
+		return errors.Errorf("Status %d is outside %d-%d", sr.Status, minCode, maxCode)
+	}
+	if sr.Delay != "" {
+		d, err := parseDuration(sr.Delay)
+		if err != nil {
+			return errors.Wrap(err, "Unable to process delay")
+		}
+		if d > maxDelay {
+			return errors.Errorf("Delay must not exceed %s", maxDelay)
+		}
+		sr.delay = d
+	}
+	return nil
+}
+
+// merge returns sr with the fields it leaves unset taken from def.
+func (sr scenarioResponse) merge(def scenarioResponse) scenarioResponse {
+	if sr.Status == 0 {
+		sr.Status = def.Status
+	}
+	if sr.Status == 0 {
+		sr.Status = http.StatusOK
+	}
+	headers := map[string]string{}
+	for k, v := range def.Headers {
+		headers[k] = v
+	}
+	for k, v := range sr.Headers {
+		headers[k] = v
+	}
+	sr.Headers = headers
+	if sr.Body == nil {
+		sr.Body = def.Body
+	}
+	if sr.Delay == "" {
+		sr.Delay, sr.delay = def.Delay, def.delay
+	}
+	return sr
+}
+
+// loadScenarios reads named scenarios from a YAML or JSON file such as
+//
+//	login:
+//	  headers: {Content-Type: application/json}
+//	  steps:
+//	    - {status: 503, repeat: 2, delay: 500ms}
+//	    - {status: 200, body: '{"token": "abc"}'}
+//
+// An empty path means no scenarios.
+func loadScenarios(path string, strict bool, maxDelay time.Duration) (map[string]*scenario, error) {
+	scenarios := map[string]*scenario{}
+	if path == "" {
+		return scenarios, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read scenario file")
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&scenarios); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse scenario file %s", path)
+	}
+	for name, s := range scenarios {
+		if s == nil {
+			s = &scenario{}
+			scenarios[name] = s
+		}
+		if err := s.validate(strict, maxDelay); err != nil {
+			return nil, errors.Wrapf(err, "Invalid scenario %q", name)
+		}
+		for i := range s.Steps {
+			step := &s.Steps[i]
+			if err := step.validate(strict, maxDelay); err != nil {
+				return nil, errors.Wrapf(err, "Invalid step %d of scenario %q", i+1, name)
+			}
+			if step.Repeat < 0 {
+				return nil, errors.Errorf("Invalid repeat %d in step %d of scenario %q", step.Repeat, i+1, name)
+			}
+			if step.Repeat == 0 {
+				step.Repeat = 1
+			}
+		}
+	}
+	return scenarios, nil
+}
+
+// response returns what the scenario serves on its nth request, counting
+// from 0.
+func (s *scenario) response(n int) scenarioResponse {
+	if len(s.Steps) == 0 {
+		return s.scenarioResponse.merge(scenarioResponse{})
+	}
+	step := s.Steps[len(s.Steps)-1]
+	for _, candidate := range s.Steps {
+		if n < candidate.Repeat {
+			step = candidate
+			break
+		}
+		n -= candidate.Repeat
+	}
+	return step.scenarioResponse.merge(s.scenarioResponse)
+}
+
+// write sends sr after its delay.
+func (sr scenarioResponse) write(w http.ResponseWriter, r *http.Request) {
+	if sr.delay > 0 {
+		extendDeadline(r, sr.delay)
+		if !sleep(r, sr.delay) {
+			return
+		}
+	}
+	for k, v := range sr.Headers {
+		w.Header().Set(k, v)
+	}
+	if sr.Body != nil && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(sr.Status)
+	if sr.Body != nil && r.Method != http.MethodHead {
+		w.Write([]byte(*sr.Body))
+	}
+}
+
+// ScenarioHandler serves the named scenarios of the scenario file, stepping
+// through each one's steps per client.
+func ScenarioHandler(scenarios map[string]*scenario, c *counters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		s, ok := scenarios[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.Errorf("Unknown scenario %q", name))
+			return
+		}
+		n := 0
+		if len(s.Steps) > 0 {
+			var err error
+			if n, err = c.next(r, clientKey(r)+" "+name); err != nil {
+				stateError(w, err)
+				return
+			}
+		}
+		s.response(n).write(w, r)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("secure")
+}
+
+var securityHeaders = [][2]string{
+	{"Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload"},
+	{"Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'; base-uri 'none'; form-action 'self'"},
+	{"X-Frame-Options", "DENY"},
+	{"X-Content-Type-Options", "nosniff"},
+	{"Referrer-Policy", "no-referrer"},
+	{"Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=(), usb=()"},
+	{"Cross-Origin-Opener-Policy", "same-origin"},
+	{"Cross-Origin-Resource-Policy", "same-origin"},
+}
+
+// secureHeaders attaches a suite of security headers when the secure query
+// parameter is true, or by default when enabled is set.
+func secureHeaders(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secure := enabled
+			if v := r.URL.Query().Get("secure"); v != "" {
+				var err error
+				if secure, err = strconv.ParseBool(v); err != nil {
+					badRequest(w, errors.Wrap(err, "Unable to process secure"))
+					return
+				}
+			}
+			if secure {
+				for _, h := range securityHeaders {
+					w.Header().Set(h[0], h[1])
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type sequenceStep struct {
+	code  string
+	count int
+}
+
+// parseSequence parses steps like 503x3,200. A step without a count is
+// used once, except for the last step which repeats forever.
+func parseSequence(r *http.Request, spec string) ([]sequenceStep, error) {
+	var steps []sequenceStep
+	for _, entry := range strings.Split(spec, ",") {
+		code, count, hasCount := strings.Cut(entry, "x")
+		step := sequenceStep{code: code, count: 1}
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("Invalid count %q for code %s", count, code)
+			}
+			step.count = n
+		}
+		if _, err := checkCode(r, code); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// SequenceHandler walks through a sequence of codes, such as 503x3,200 for
+// "503 three times, then 200 forever". Progress is tracked per scenario
+// query parameter, or per client and sequence when it is absent.
+func SequenceHandler(c *counters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		spec := mux.Vars(r)["steps"]
+		steps, err := parseSequence(r, spec)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		key := r.URL.Query().Get("scenario")
+		if key == "" {
+			key = clientKey(r) + " " + spec
+		}
+		n, err := c.next(r, key)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+
+		code := steps[len(steps)-1].code
+		for _, step := range steps {
+			if n < step.count {
+				code = step.code
+				break
+			}
+			n -= step.count
+		}
+		StatusHandler(w, mux.SetURLVars(r, map[string]string{"code": code}))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sessionID restricts session IDs to what is safe in keys and cookies.
+var sessionID = regexp.MustCompile(`^[0-9A-Za-z._-]{1,128}$`)
+
+// session scopes the state of sequences, cycles, scenarios and stub
+// scenario states, so that callers sharing an instance don't see each
+// other's progress. All of a session's state expires with it.
+type session struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// key returns where the session keeps key in the state store.
+func (s *session) key(key string) string {
+	return "session:" + s.ID + ":" + key
+}
+
+// sessions keeps sessions in the state store at session:{id}. A session is
+// created by POST /session or by the first request naming it.
+type sessions struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newSessions(store Store, ttl time.Duration) *sessions {
+	return &sessions{store: store, ttl: ttl}
+}
+
+// get returns the live session id, starting it if there is none.
+func (s *sessions) get(id string) (*session, error) {
+	for {
+		v, ok, err := s.store.Get("session:" + id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			var ss session
+			if err := json.Unmarshal(v, &ss); err != nil {
+				return nil, errors.Wrapf(err, "Unable to process session %q", id)
+			}
+			return &ss, nil
+		}
+		now := time.Now().UTC()
+		ss := &session{ID: id, Created: now, Expires: now.Add(s.ttl)}
+		meta, _ := json.Marshal(ss)
+		if swapped, err := s.store.CompareAndSwap("session:"+id, nil, meta, s.ttl); err != nil || swapped {
+			return ss, err
+		}
+	}
+}
+
+// reset drops everything stored for the session, which carries on.
+func (s *sessions) reset(ss *session) (int, error) {
+	return s.store.DeletePrefix(ss.key(""))
+}
+
+// requestSession returns the caller's session, if it named one.
+func requestSession(r *http.Request) *session {
+	ss, _ := r.Context().Value(sessionKey).(*session)
+	return ss
+}
+
+// scopedKey returns where key lives for the caller, and the TTL to store it
+// with, which within a session is at most what is left of it.
+func scopedKey(r *http.Request, key string, ttl time.Duration) (string, time.Duration) {
+	ss := requestSession(r)
+	if ss == nil {
+		return key, ttl
+	}
+	left := time.Until(ss.Expires)
+	if left < time.Millisecond {
+		left = time.Millisecond
+	}
+	if ttl <= 0 || ttl > left {
+		ttl = left
+	}
+	return ss.key(key), ttl
+}
+
+// sessionScoping puts the session named by the X-Session-Id header or the
+// session_id cookie in the request context.
+func sessionScoping(s *sessions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Session-Id")
+			if id == "" {
+				if c, err := r.Cookie("session_id"); err == nil {
+					id = c.Value
+				}
+			}
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !sessionID.MatchString(id) {
+				badRequest(w, errors.Errorf("Invalid session %q, expected up to 128 letters, digits, dots, dashes or underscores", id))
+				return
+			}
+			ss, err := s.get(id)
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey, ss)))
+		})
+	}
+}
+
+// SessionHandler shows the caller's session, or starts a new one with POST
+// and hands it out as the session_id cookie.
+func SessionHandler(s *sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			ss := requestSession(r)
+			if ss == nil {
+				writeError(w, http.StatusNotFound, errors.New("No session, send X-Session-Id or POST /session"))
+				return
+			}
+			writeJSON(w, http.StatusOK, ss)
+		case http.MethodPost:
+			ss, err := s.get(newUUID())
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     "session_id",
+				Value:    ss.ID,
+				Path:     "/",
+				Expires:  ss.Expires,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			writeJSON(w, http.StatusCreated, ss)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+		}
+	}
+}
+
+// SessionResetHandler starts the caller's session over, forgetting its
+// sequences, cycles, scenarios and stub scenario states.
+func SessionResetHandler(s *sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		ss := requestSession(r)
+		if ss == nil {
+			writeError(w, http.StatusNotFound, errors.New("No session, send X-Session-Id or POST /session"))
+			return
+		}
+		if _, err := s.reset(ss); err != nil {
+			stateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
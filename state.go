@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxStateKeys caps how many keys the in-memory store holds at once.
+const maxStateKeys = 100000
+
+// Store holds the state of the stateful endpoints, such as sequences, bins,
+// idempotency keys and the /store sandbox, so that replicas sharing a backend
+// behave as one. A ttl of 0 keeps a value until it is deleted.
+type Store interface {
+	// Get returns the value at key, and whether it is set.
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	// CompareAndSwap replaces the value at key with value if it currently
+	// holds old, and reports whether it did. A nil old means key must not be
+	// set, and a nil value deletes key.
+	CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes key and reports whether it was set.
+	Delete(key string) (bool, error)
+	// Incr adds one to the counter at key and returns the new count. The
+	// counter expires ttl after it was last incremented.
+	Incr(key string, ttl time.Duration) (int64, error)
+	// DeletePrefix removes every key starting with prefix and returns how
+	// many there were.
+	DeletePrefix(prefix string) (int, error)
+}
+
+// newStore returns the Store for backend, memory or redis.
+func newStore(backend, redisURL string) (Store, error) {
+	switch backend {
+	case "", "memory":
+		return newMemoryStore(), nil
+	case "redis":
+		return newRedisStore(redisURL)
+	default:
+		return nil, errors.Errorf("Unknown state backend %q, expected memory or redis", backend)
+	}
+}
+
+// stateError reports a failure of the state store as a 503.
+func stateError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusServiceUnavailable, errors.Wrap(err, "Unable to use state store"))
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e memoryEntry) live(now time.Time) bool {
+	return e.expires.IsZero() || now.Before(e.expires)
+}
+
+// memoryStore is a Store local to this process.
+type memoryStore struct {
+	mu sync.Mutex
+	m  map[string]memoryEntry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{m: map[string]memoryEntry{}}
+}
+
+// get returns the live value at key. The caller holds the lock.
+func (s *memoryStore) get(key string, now time.Time) ([]byte, bool) {
+	e, ok := s.m[key]
+	if ok && !e.live(now) {
+		delete(s.m, key)
+		return nil, false
+	}
+	return e.value, ok
+}
+
+// set stores value at key, first dropping expired keys if full. The caller
+// holds the lock.
+func (s *memoryStore) set(key string, value []byte, ttl time.Duration, now time.Time) error {
+	if _, ok := s.m[key]; !ok && len(s.m) >= maxStateKeys {
+		for k, e := range s.m {
+			if !e.live(now) {
+				delete(s.m, k)
+			}
+		}
+		if len(s.m) >= maxStateKeys {
+			return errors.Errorf("State store is full, at most %d keys are kept", maxStateKeys)
+		}
+	}
+	e := memoryEntry{value: append([]byte{}, value...)}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.m[key] = e
+	return nil
+}
+
+func (s *memoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.get(key, time.Now())
+	return append([]byte(nil), v...), ok, nil
+}
+
+func (s *memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(key, value, ttl, time.Now())
+}
+
+func (s *memoryStore) CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	current, ok := s.get(key, now)
+	if ok != (old != nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+	if value == nil {
+		delete(s.m, key)
+		return true, nil
+	}
+	return true, s.set(key, value, ttl, now)
+}
+
+func (s *memoryStore) Delete(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.get(key, time.Now())
+	delete(s.m, key)
+	return ok, nil
+}
+
+func (s *memoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	v, ok := s.get(key, now)
+	if !ok {
+		return 1, s.set(key, []byte("1"), ttl, now)
+	}
+	n, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("Value at %q is not a counter", key)
+	}
+	n++
+	e := s.m[key]
+	e.value = []byte(strconv.FormatInt(n, 10))
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.m[key] = e
+	return n, nil
+}
+
+func (s *memoryStore) DeletePrefix(prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for k, e := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			if e.live(now) {
+				n++
+			}
+			delete(s.m, k)
+		}
+	}
+	return n, nil
+}
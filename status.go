@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("reason", "strict")
+}
+
+// statusCodes records whether codes are strictly validated by default, and
+// writes status lines net/http can't produce directly to the connection:
+// codes outside 100-999, and custom reason phrases requested with the
+// reason query parameter.
+func statusCodes(strict bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reason := r.URL.Query().Get("reason")
+			if strings.ContainsAny(reason, "\r\n") {
+				badRequest(w, errors.New("Reason must not contain line breaks"))
+				return
+			}
+			rw := &rawStatusWriter{ResponseWriter: w, reason: reason, head: r.Method == http.MethodHead}
+			defer rw.Close()
+			ctx := context.WithValue(r.Context(), strictCodesKey, strict)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// rawStatusWriter hijacks the connection to write a status line by hand
+// when net/http can't write the one asked for. The response is then
+// delimited by closing the connection.
+type rawStatusWriter struct {
+	http.ResponseWriter
+	reason      string
+	head        bool
+	conn        net.Conn
+	buf         *bufio.ReadWriter
+	wroteHeader bool
+	// failed is set when the connection could not be taken over, as on
+	// HTTP/2, and the body is then dropped.
+	failed bool
+}
+
+func (rw *rawStatusWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rw.wroteHeader = true
+	if code >= 100 && code <= 999 && rw.reason == "" {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	reason := rw.reason
+	if reason == "" {
+		reason = http.StatusText(code)
+	}
+	if err := rw.writeRaw(fmt.Sprintf("%03d", code), reason); err != nil && rw.conn == nil {
+		rw.failed = true
+		writeError(rw.ResponseWriter, http.StatusNotImplemented,
+			errors.Wrapf(err, "Status %d with reason %q needs HTTP/1.1", code, reason))
+	}
+}
+
+func (rw *rawStatusWriter) writeRaw(code, reason string) error {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return errors.New("response does not support hijacking")
+	}
+	conn, buf, err := h.Hijack()
+	if err != nil {
+		return err
+	}
+	rw.conn, rw.buf = conn, buf
+
+	header := rw.Header().Clone()
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	header.Set("Connection", "close")
+	fmt.Fprintf(buf, "HTTP/1.1 %s %s\r\n", code, reason)
+	header.Write(buf)
+	_, err = buf.WriteString("\r\n")
+	return err
+}
+
+func (rw *rawStatusWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.failed {
+		return len(b), nil
+	}
+	if rw.buf == nil {
+		return rw.ResponseWriter.Write(b)
+	}
+	// net/http drops the body of a HEAD response; do the same by hand.
+	if rw.head {
+		return len(b), nil
+	}
+	return rw.buf.Write(b)
+}
+
+func (rw *rawStatusWriter) Flush() {
+	if rw.buf != nil {
+		rw.buf.Flush()
+		return
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *rawStatusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if rw.conn != nil {
+		return nil, nil, errors.New("connection already hijacked")
+	}
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (rw *rawStatusWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Close flushes and closes a hijacked connection.
+func (rw *rawStatusWriter) Close() error {
+	if rw.conn == nil {
+		return nil
+	}
+	rw.buf.Flush()
+	return rw.conn.Close()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+type storeObject struct {
+	Body        []byte    `json:"body"`
+	ContentType string    `json:"content_type"`
+	ETag        string    `json:"etag"`
+	Modified    time.Time `json:"modified"`
+	Expires     time.Time `json:"expires"`
+}
+
+// objectStore is the TTL-bounded sandbox behind /store, kept in the state
+// store under object:{bucket}/{key}.
+type objectStore struct {
+	store Store
+	ttl   time.Duration
+}
+
+func newObjectStore(store Store, ttl time.Duration) *objectStore {
+	return &objectStore{store: store, ttl: ttl}
+}
+
+func objectETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// StoreHandler is a REST sandbox over the state store. GET and HEAD fetch
+// an object with its ETag, PUT creates (201) or replaces (200) it and DELETE
+// removes it (204). Missing objects are a 404. If-Match and
+// If-Unmodified-Since guard writes with 412, as does If-None-Match: * on a
+// PUT that would replace. Objects expire after the ttl query parameter, which
+// may not exceed the store's own TTL.
+func StoreHandler(s *objectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		key := vars["bucket"] + "/" + vars["key"]
+		var (
+			put *storeObject
+			ttl time.Duration
+		)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+		case http.MethodPut:
+			var err error
+			if ttl, err = durationParam(r, "ttl", s.ttl); err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process ttl"))
+				return
+			}
+			if ttl <= 0 || ttl > s.ttl {
+				badRequest(w, errors.Errorf("TTL must be between 1ms and %s", s.ttl))
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			if err != nil {
+				writeError(w, http.StatusRequestEntityTooLarge, errors.Wrap(err, "Unable to read body"))
+				return
+			}
+			contentType := r.Header.Get("Content-Type")
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			put = &storeObject{Body: body, ContentType: contentType, ETag: objectETag(body)}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+
+		raw, exists, err := s.store.Get("object:" + key)
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		var current storeObject
+		if exists {
+			if err := json.Unmarshal(raw, &current); err != nil {
+				stateError(w, err)
+				return
+			}
+		} else {
+			raw = nil
+		}
+		code := http.StatusOK
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			if !exists {
+				code = http.StatusNotFound
+			}
+		case preconditionFailed(r, current.ETag, current.Modified, exists),
+			put != nil && exists && etagMatches(r.Header.Get("If-None-Match"), current.ETag, true):
+			code = http.StatusPreconditionFailed
+		case put == nil && !exists:
+			code = http.StatusNotFound
+		default:
+			var value []byte
+			if put != nil {
+				now := time.Now().UTC()
+				put.Modified, put.Expires = now, now.Add(ttl)
+				value, _ = json.Marshal(put)
+			}
+			// A write that raced with this one fails its precondition.
+			swapped, err := s.store.CompareAndSwap("object:"+key, raw, value, ttl)
+			switch {
+			case err != nil:
+				stateError(w, err)
+				return
+			case !swapped:
+				code = http.StatusPreconditionFailed
+			case put == nil:
+				code = http.StatusNoContent
+			case !exists:
+				code = http.StatusCreated
+			}
+			if swapped && put != nil {
+				current = *put
+			}
+		}
+
+		switch code {
+		case http.StatusNotFound:
+			writeError(w, code, errors.Errorf("Object %q does not exist", key))
+			return
+		case http.StatusPreconditionFailed:
+			if exists {
+				w.Header().Set("ETag", current.ETag)
+			}
+			writeError(w, code, errors.Errorf("Precondition failed for %q", key))
+			return
+		case http.StatusNoContent:
+			w.WriteHeader(code)
+			return
+		}
+
+		w.Header().Set("ETag", current.ETag)
+		w.Header().Set("Last-Modified", current.Modified.Format(http.TimeFormat))
+		w.Header().Set("Expires", current.Expires.Format(http.TimeFormat))
+		if put != nil {
+			if code == http.StatusCreated {
+				w.Header().Set("Location", r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"bucket":  vars["bucket"],
+				"key":     vars["key"],
+				"etag":    current.ETag,
+				"size":    len(current.Body),
+				"expires": current.Expires,
+			})
+			return
+		}
+		if notModified(r, current.ETag, current.Modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", current.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(current.Body)
+	}
+}
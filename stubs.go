@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	// stubsKey is where the stubs live in the state store, as one JSON list
+	// so that every replica sees the same set.
+	stubsKey = "stubs"
+	// stubsRefresh is how long matching uses the stubs it last loaded
+	// before checking the store for changes.
+	stubsRefresh = time.Second
+	// scenarioStarted is the state every stub scenario starts in. It is
+	// kept in the store as no value at all.
+	scenarioStarted = "Started"
+)
+
+// stringMatcher tests a header, query parameter or body. Every condition
+// given must hold; absent instead requires there to be no value at all.
+type stringMatcher struct {
+	EqualTo     *string         `json:"equal_to,omitempty"`
+	Contains    string          `json:"contains,omitempty"`
+	Matches     string          `json:"matches,omitempty"`
+	EqualToJSON json.RawMessage `json:"equal_to_json,omitempty"`
+	Absent      bool            `json:"absent,omitempty"`
+
+	pattern *regexp.Regexp
+	json    interface{}
+}
+
+func (m *stringMatcher) compile() error {
+	if m.Matches != "" {
+		var err error
+		if m.pattern, err = regexp.Compile(m.Matches); err != nil {
+			return errors.Wrapf(err, "Invalid matches %q", m.Matches)
+		}
+	}
+	if len(m.EqualToJSON) > 0 {
+		if err := json.Unmarshal(m.EqualToJSON, &m.json); err != nil {
+			return errors.Wrap(err, "Invalid equal_to_json")
+		}
+	}
+	return nil
+}
+
+func (m *stringMatcher) matches(v string) bool {
+	if m.EqualTo != nil && v != *m.EqualTo {
+		return false
+	}
+	if m.Contains != "" && !strings.Contains(v, m.Contains) {
+		return false
+	}
+	if m.pattern != nil && !m.pattern.MatchString(v) {
+		return false
+	}
+	if m.json != nil {
+		var doc interface{}
+		if json.Unmarshal([]byte(v), &doc) != nil || !reflect.DeepEqual(doc, m.json) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny applies m to a multi-valued header or query parameter.
+func (m *stringMatcher) matchesAny(values []string) bool {
+	if m.Absent {
+		return len(values) == 0
+	}
+	for _, v := range values {
+		if m.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// stubRequest selects the requests a stub answers. An empty method matches
+// any, path must be equal and path_pattern is a regular expression.
+type stubRequest struct {
+	Method      string                    `json:"method,omitempty"`
+	Path        string                    `json:"path,omitempty"`
+	PathPattern string                    `json:"path_pattern,omitempty"`
+	Headers     map[string]*stringMatcher `json:"headers,omitempty"`
+	Query       map[string]*stringMatcher `json:"query,omitempty"`
+	Body        []*stringMatcher          `json:"body,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// stub is a canned response. Stubs sharing a scenario form a state machine,
+// WireMock style: a stub with required_state only matches while its scenario
+// is in that state, and one with new_state moves the scenario on once it
+// has answered.
+type stub struct {
+	ID            string           `json:"id"`
+	Scenario      string           `json:"scenario,omitempty"`
+	RequiredState string           `json:"required_state,omitempty"`
+	NewState      string           `json:"new_state,omitempty"`
+	Request       stubRequest      `json:"request"`
+	Response      scenarioResponse `json:"response"`
+	Created       time.Time        `json:"created"`
+}
+
+// scenarioStateKey returns where the state of the named scenario is kept
+// for the caller, and for how long.
+func scenarioStateKey(r *http.Request, name string) (string, time.Duration) {
+	return scopedKey(r, "scenario-state:"+name, 0)
+}
+
+func (s *stub) compile(strict bool, maxDelay time.Duration) error {
+	if s.Scenario == "" && (s.RequiredState != "" || s.NewState != "") {
+		return errors.New("required_state and new_state need a scenario")
+	}
+	req := &s.Request
+	if req.Path != "" && req.PathPattern != "" {
+		return errors.New("request needs path or path_pattern, not both")
+	}
+	if req.PathPattern != "" {
+		var err error
+		if req.pattern, err = regexp.Compile(req.PathPattern); err != nil {
+			return errors.Wrapf(err, "Invalid path_pattern %q", req.PathPattern)
+		}
+	}
+	for name, m := range req.Headers {
+		if !validHeaderName(name) || m == nil {
+			return errors.Errorf("Invalid header matcher %q", name)
+		}
+		if err := m.compile(); err != nil {
+			return errors.Wrapf(err, "Invalid header matcher %q", name)
+		}
+	}
+	for name, m := range req.Query {
+		if m == nil {
+			return errors.Errorf("Invalid query matcher %q", name)
+		}
+		if err := m.compile(); err != nil {
+			return errors.Wrapf(err, "Invalid query matcher %q", name)
+		}
+	}
+	for i, m := range req.Body {
+		if m == nil {
+			return errors.Errorf("Invalid body matcher %d", i)
+		}
+		if err := m.compile(); err != nil {
+			return errors.Wrapf(err, "Invalid body matcher %d", i)
+		}
+	}
+	if err := s.Response.validate(strict, maxDelay); err != nil {
+		return errors.Wrap(err, "Invalid response")
+	}
+	return nil
+}
+
+// matchesHead checks everything but the body.
+func (s *stub) matchesHead(r *http.Request) bool {
+	req := &s.Request
+	if req.Method != "" && !strings.EqualFold(req.Method, r.Method) {
+		return false
+	}
+	if req.Path != "" && req.Path != r.URL.Path {
+		return false
+	}
+	if req.pattern != nil && !req.pattern.MatchString(r.URL.Path) {
+		return false
+	}
+	for name, m := range req.Headers {
+		if !m.matchesAny(r.Header.Values(name)) {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for name, m := range req.Query {
+		if !m.matchesAny(query[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *stub) matchesBody(body []byte) bool {
+	for _, m := range s.Request.Body {
+		if !m.matchesAny([]string{string(body)}) {
+			return false
+		}
+	}
+	return true
+}
+
+// stubs keeps the registered stubs in the state store, caching the compiled
+// list until the stored one changes. With a file, the stubs are also saved
+// there after every change so that they outlive the process.
+type stubs struct {
+	store    Store
+	strict   bool
+	maxDelay time.Duration
+	file     string
+
+	mu       sync.Mutex
+	raw      []byte
+	compiled []*stub
+	checked  time.Time
+}
+
+func newStubs(store Store, strict bool, maxDelay time.Duration, file string) *stubs {
+	return &stubs{store: store, strict: strict, maxDelay: maxDelay, file: file}
+}
+
+// restore replaces the stubs with those saved in the file, if there is one.
+func (s *stubs) restore() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Unable to read stubs file")
+	}
+	var saved []*stub
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return errors.Wrapf(err, "Unable to parse stubs file %s", s.file)
+	}
+	for _, st := range saved {
+		if err := st.compile(s.strict, s.maxDelay); err != nil {
+			return errors.Wrapf(err, "Invalid stub %s in %s", st.ID, s.file)
+		}
+	}
+	return s.update(func([]*stub) []*stub { return saved })
+}
+
+// save writes list to the file, replacing it atomically.
+func (s *stubs) save(list []*stub) error {
+	if list == nil {
+		list = []*stub{}
+	}
+	data, _ := json.MarshalIndent(list, "", "  ")
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "Unable to save stubs file")
+	}
+	return errors.Wrap(os.Rename(tmp, s.file), "Unable to save stubs file")
+}
+
+// load returns the current stubs, newest first, and their stored form.
+func (s *stubs) load() ([]*stub, []byte, error) {
+	raw, ok, err := s.store.Get(stubsKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		s.mu.Lock()
+		s.raw, s.compiled, s.checked = nil, nil, time.Now()
+		s.mu.Unlock()
+		return nil, nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes.Equal(raw, s.raw) {
+		s.checked = time.Now()
+		return s.compiled, raw, nil
+	}
+	var list []*stub
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, nil, errors.Wrap(err, "Unable to process stored stubs")
+	}
+	for _, st := range list {
+		if err := st.compile(s.strict, s.maxDelay); err != nil {
+			return nil, nil, errors.Wrapf(err, "Invalid stored stub %s", st.ID)
+		}
+	}
+	s.raw, s.compiled, s.checked = raw, list, time.Now()
+	return list, raw, nil
+}
+
+// current returns the stubs for matching, loading them at most once every
+// stubsRefresh. If the store fails, the last stubs loaded are used, or none
+// if there are none yet, so that the built-in routes carry on working.
+func (s *stubs) current() []*stub {
+	s.mu.Lock()
+	list, fresh := s.compiled, time.Since(s.checked) < stubsRefresh
+	s.mu.Unlock()
+	if fresh {
+		return list
+	}
+	if loaded, _, err := s.load(); err == nil {
+		return loaded
+	}
+	return list
+}
+
+// update applies change to the stored list, retrying if another replica
+// changed it meanwhile.
+func (s *stubs) update(change func([]*stub) []*stub) error {
+	for {
+		list, raw, err := s.load()
+		if err != nil {
+			return err
+		}
+		list = change(append([]*stub{}, list...))
+		var value []byte
+		if len(list) > 0 {
+			value, _ = json.Marshal(list)
+		}
+		swapped, err := s.store.CompareAndSwap(stubsKey, raw, value, 0)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			// Match with the new stubs right away.
+			s.mu.Lock()
+			s.checked = time.Time{}
+			s.mu.Unlock()
+			if s.file != "" {
+				return s.save(list)
+			}
+			return nil
+		}
+	}
+}
+
+// match returns the newest stub matching r, and the stored state of its
+// scenario. Bodies are read, and put back, only when a stub that otherwise
+// matches looks at them.
+func (s *stubs) match(r *http.Request) (*stub, []byte, error) {
+	list := s.current()
+	var err error
+	var body []byte
+	read := false
+	states := map[string][]byte{}
+	for _, st := range list {
+		if !st.matchesHead(r) {
+			continue
+		}
+		state, ok := states[st.Scenario]
+		if st.Scenario != "" && !ok {
+			key, _ := scenarioStateKey(r, st.Scenario)
+			if state, _, err = s.store.Get(key); err != nil {
+				return nil, nil, err
+			}
+			states[st.Scenario] = state
+		}
+		if st.RequiredState != "" && st.RequiredState != scenarioState(state) {
+			continue
+		}
+		if len(st.Request.Body) == 0 {
+			return st, state, nil
+		}
+		if !read {
+			if body, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize)); err != nil {
+				return nil, nil, err
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			read = true
+		}
+		if st.matchesBody(body) {
+			return st, state, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func scenarioState(stored []byte) string {
+	if stored == nil {
+		return scenarioStarted
+	}
+	return string(stored)
+}
+
+// transition moves the stub's scenario on from the state it was matched in,
+// reporting false if another request moved it first.
+func (s *stubs) transition(r *http.Request, st *stub, from []byte) (bool, error) {
+	if st.NewState == "" {
+		return true, nil
+	}
+	var to []byte
+	if st.NewState != scenarioStarted {
+		to = []byte(st.NewState)
+	}
+	key, ttl := scenarioStateKey(r, st.Scenario)
+	return s.store.CompareAndSwap(key, from, to, ttl)
+}
+
+// stubbing answers requests matching a registered stub with its canned
+// response, ahead of the built-in routes. The admin API is left alone.
+func stubbing(s *stubs) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for {
+				st, state, err := s.match(r)
+				if err != nil {
+					stateError(w, err)
+					return
+				}
+				if st == nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+				// Match again if the scenario moved on meanwhile, as a
+				// different stub may answer now.
+				if moved, err := s.transition(r, st, state); err != nil {
+					stateError(w, err)
+					return
+				} else if !moved {
+					continue
+				}
+				w.Header().Set("X-Stub-Id", st.ID)
+				st.Response.merge(scenarioResponse{}).write(w, r)
+				return
+			}
+		})
+	}
+}
+
+// StubsHandler lists the stubs, newest first, registers one with POST and
+// removes them all with DELETE.
+func StubsHandler(s *stubs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			list, _, err := s.load()
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			if list == nil {
+				list = []*stub{}
+			}
+			writeJSON(w, http.StatusOK, list)
+		case http.MethodPost:
+			var st stub
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&st); err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process stub"))
+				return
+			}
+			if err := st.compile(s.strict, s.maxDelay); err != nil {
+				badRequest(w, err)
+				return
+			}
+			st.ID, st.Created = newUUID(), time.Now().UTC()
+			if err := s.update(func(list []*stub) []*stub { return append([]*stub{&st}, list...) }); err != nil {
+				stateError(w, err)
+				return
+			}
+			w.Header().Set("Location", "/admin/stubs/"+st.ID)
+			writeJSON(w, http.StatusCreated, st)
+		case http.MethodDelete:
+			if err := s.update(func([]*stub) []*stub { return nil }); err != nil {
+				stateError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+		}
+	}
+}
+
+// StubHandler shows one stub, or removes it with DELETE.
+func StubHandler(s *stubs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			list, _, err := s.load()
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			for _, st := range list {
+				if st.ID == id {
+					writeJSON(w, http.StatusOK, st)
+					return
+				}
+			}
+		case http.MethodDelete:
+			found := false
+			err := s.update(func(list []*stub) []*stub {
+				kept := list[:0]
+				found = false
+				for _, st := range list {
+					if st.ID == id {
+						found = true
+						continue
+					}
+					kept = append(kept, st)
+				}
+				return kept
+			})
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			if found {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		writeError(w, http.StatusNotFound, errors.Errorf("Stub %q does not exist", id))
+	}
+}
+
+// ScenariosHandler lists the scenarios of the stubs and the state each is
+// in, within the caller's session if it has one.
+func ScenariosHandler(s *stubs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		list, _, err := s.load()
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		scenarios := []map[string]string{}
+		seen := map[string]bool{}
+		for _, st := range list {
+			if st.Scenario == "" || seen[st.Scenario] {
+				continue
+			}
+			seen[st.Scenario] = true
+			key, _ := scenarioStateKey(r, st.Scenario)
+			state, _, err := s.store.Get(key)
+			if err != nil {
+				stateError(w, err)
+				return
+			}
+			scenarios = append(scenarios, map[string]string{"name": st.Scenario, "state": scenarioState(state)})
+		}
+		sort.Slice(scenarios, func(i, j int) bool { return scenarios[i]["name"] < scenarios[j]["name"] })
+		writeJSON(w, http.StatusOK, scenarios)
+	}
+}
+
+// ScenarioResetHandler puts a scenario back in its Started state, within the
+// caller's session if it has one. Scenarios no stub has are not found.
+func ScenarioResetHandler(s *stubs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		name := mux.Vars(r)["name"]
+		list, _, err := s.load()
+		if err != nil {
+			stateError(w, err)
+			return
+		}
+		found := false
+		for _, st := range list {
+			found = found || st.Scenario == name
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errors.Errorf("No stub has scenario %q", name))
+			return
+		}
+		key, _ := scenarioStateKey(r, name)
+		if _, err := s.store.Delete(key); err != nil {
+			stateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
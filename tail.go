@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tailHeartbeat is how often an idle /admin/tail stream sends a comment to
+// keep proxies and the write deadline from closing it.
+const tailHeartbeat = 15 * time.Second
+
+// tailBacklog is how many summaries a subscriber may fall behind by before
+// new ones are dropped for it.
+const tailBacklog = 64
+
+type requestSummary struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	Remote    string    `json:"remote"`
+}
+
+// tail fans request summaries out to live subscribers.
+type tail struct {
+	mu   sync.Mutex
+	subs map[chan requestSummary]bool
+}
+
+func newTail() *tail {
+	return &tail{subs: map[chan requestSummary]bool{}}
+}
+
+func (t *tail) subscribe() chan requestSummary {
+	ch := make(chan requestSummary, tailBacklog)
+	t.mu.Lock()
+	t.subs[ch] = true
+	t.mu.Unlock()
+	return ch
+}
+
+func (t *tail) unsubscribe(ch chan requestSummary) {
+	t.mu.Lock()
+	delete(t.subs, ch)
+	t.mu.Unlock()
+}
+
+// publish hands s to every subscriber without waiting on slow ones.
+func (t *tail) publish(s requestSummary) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch := range t.subs {
+		select {
+		case ch <- s:
+		default:
+		}
+	}
+}
+
+// tailing publishes a summary of every request apart from the admin API to t
+// once it has been served.
+func tailing(t *tail) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			code := http.StatusOK
+			hw := &hookWriter{ResponseWriter: w, hook: func(c int) { code = c }}
+			defer func() {
+				requestID, ok := r.Context().Value(requestIDKey).(string)
+				if !ok {
+					requestID = "unknown"
+				}
+				t.publish(requestSummary{
+					Time:      start,
+					RequestID: requestID,
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Status:    code,
+					LatencyMS: milliseconds(time.Since(start)),
+					Remote:    r.RemoteAddr,
+				})
+			}()
+			next.ServeHTTP(hw, r)
+		})
+	}
+}
+
+// TailHandler streams request summaries as server-sent events until the
+// client goes away.
+func TailHandler(t *tail) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, errors.New("Streaming is not supported"))
+			return
+		}
+		ch := t.subscribe()
+		defer t.unsubscribe(ch)
+
+		extendDeadline(r, tailHeartbeat)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": tailing requests\n\n")
+		flusher.Flush()
+
+		ticker := time.NewTicker(tailHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				extendDeadline(r, tailHeartbeat)
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case s := <-ch:
+				extendDeadline(r, tailHeartbeat)
+				data, _ := json.Marshal(s)
+				fmt.Fprintf(w, "event: request\nid: %s\ndata: %s\n\n", s.RequestID, data)
+			}
+			flusher.Flush()
+		}
+	}
+}
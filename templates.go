@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("template", "template-name")
+}
+
+// templateData is the value templates are executed with.
+type templateData struct {
+	Code      int
+	Reason    string
+	RequestID string
+	Now       time.Time
+	Path      string
+	Query     url.Values
+}
+
+// loadTemplates parses every *.tmpl file in dir, naming each template after
+// its file name without the extension. An empty dir yields no templates.
+func loadTemplates(dir string) (*template.Template, error) {
+	tmpls := template.New("")
+	if dir == "" {
+		return tmpls, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		name = name[:len(name)-len(filepath.Ext(name))]
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpls.New(name).Parse(string(text)); err != nil {
+			return nil, errors.Wrapf(err, "Unable to parse template %s", file)
+		}
+	}
+	return tmpls, nil
+}
+
+// templating replaces the response body with a rendered template when the
+// template (inline text) or template-name (one of tmpls) query parameter is
+// set. The wrapped handler still decides the status code and headers.
+func templating(tmpls *template.Template) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			var tmpl *template.Template
+			switch {
+			case query.Get("template") != "":
+				var err error
+				tmpl, err = template.New("inline").Parse(query.Get("template"))
+				if err != nil {
+					badRequest(w, errors.Wrap(err, "Unable to parse template"))
+					return
+				}
+			case query.Get("template-name") != "":
+				tmpl = tmpls.Lookup(query.Get("template-name"))
+				if tmpl == nil {
+					badRequest(w, errors.Errorf("Unknown template %q", query.Get("template-name")))
+					return
+				}
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bw := &bodyOverrideWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(bw, r)
+
+			requestID, _ := r.Context().Value(requestIDKey).(string)
+			w.Header().Del("Content-Length")
+			w.WriteHeader(bw.code)
+			tmpl.Execute(w, templateData{
+				Code:      bw.code,
+				Reason:    http.StatusText(bw.code),
+				RequestID: requestID,
+				Now:       time.Now(),
+				Path:      r.URL.Path,
+				Query:     query,
+			})
+		})
+	}
+}
+
+// bodyOverrideWriter records the status code written by a handler and
+// discards its body, so that a different body can be written in its place.
+type bodyOverrideWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (bw *bodyOverrideWriter) WriteHeader(code int) {
+	bw.code = code
+}
+
+func (bw *bodyOverrideWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
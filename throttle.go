@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("rate")
+}
+
+var rateUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"gbps", 1e9},
+	{"mbps", 1e6},
+	{"kbps", 1e3},
+	{"bps", 1},
+}
+
+// parseRate parses a bandwidth such as "64kbps" or "1.5mbps" into bytes per
+// second. Units are decimal multiples of bits per second; a bare number is
+// taken as bits per second.
+func parseRate(v string) (float64, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	scale := 1.0
+	for _, u := range rateUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, scale = strings.TrimSuffix(v, u.suffix), u.scale
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid rate")
+	}
+	bytes := f * scale / 8
+	if bytes < 1 {
+		return 0, errors.New("rate must be at least 8bps")
+	}
+	return bytes, nil
+}
+
+// throttle limits how fast the response body is written to the rate query
+// parameter.
+func throttle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("rate")
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rate, err := parseRate(v)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process rate"))
+			return
+		}
+
+		// The bucket holds 50ms worth of bytes, so writes go out in small
+		// bursts rather than all at once.
+		burst := rate / 20
+		if burst < 1 {
+			burst = 1
+		}
+		next.ServeHTTP(&throttleWriter{ResponseWriter: w, r: r, rate: rate, burst: burst, tokens: burst, last: time.Now()}, r)
+	})
+}
+
+// throttleWriter is a token bucket: each byte written takes a token, and
+// tokens refill at rate per second up to burst.
+type throttleWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (tw *throttleWriter) refill() {
+	now := time.Now()
+	tw.tokens += now.Sub(tw.last).Seconds() * tw.rate
+	if tw.tokens > tw.burst {
+		tw.tokens = tw.burst
+	}
+	tw.last = now
+}
+
+func (tw *throttleWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if float64(n) > tw.burst {
+			n = int(tw.burst)
+		}
+		tw.refill()
+		if need := float64(n) - tw.tokens; need > 0 {
+			wait := time.Duration(need / tw.rate * float64(time.Second))
+			extendDeadline(tw.r, wait)
+			if !sleep(tw.r, wait) {
+				return written, tw.r.Context().Err()
+			}
+			tw.refill()
+		}
+		tw.tokens -= float64(n)
+
+		m, err := tw.ResponseWriter.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		tw.Flush()
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (tw *throttleWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *throttleWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (tw *throttleWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("timeout")
+}
+
+// deadlines lets handlers move the read and write deadlines of the
+// connection serving them past the server-wide timeouts, up to max.
+type deadlines struct {
+	conn  net.Conn
+	read  time.Duration
+	write time.Duration
+	max   time.Duration
+}
+
+// connDeadlines returns a ConnContext function that attaches deadlines for
+// each connection to its context.
+func connDeadlines(read, write, max time.Duration) func(context.Context, net.Conn) context.Context {
+	return func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, deadlinesKey, &deadlines{conn: c, read: read, write: write, max: max})
+	}
+}
+
+// extendDeadline gives the current response d on top of the usual write
+// timeout, for handlers that deliberately take a long time. d is capped at
+// the configured maximum.
+func extendDeadline(r *http.Request, d time.Duration) {
+	dl, ok := r.Context().Value(deadlinesKey).(*deadlines)
+	if !ok || dl.write <= 0 {
+		return
+	}
+	if d > dl.max {
+		d = dl.max
+	}
+	dl.conn.SetWriteDeadline(time.Now().Add(d + dl.write))
+}
+
+// timeoutOverride replaces the server's read and write timeouts for a single
+// request with the timeout query parameter, which may be shorter or longer
+// than the defaults but not above the configured maximum.
+func timeoutOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("timeout")
+		dl, ok := r.Context().Value(deadlinesKey).(*deadlines)
+		if v == "" || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d, err := parseDuration(v)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process timeout"))
+			return
+		}
+		if d == 0 || d > dl.max {
+			badRequest(w, errors.Errorf("Timeout must be between 1ms and %s", dl.max))
+			return
+		}
+
+		dl.conn.SetReadDeadline(time.Now().Add(d))
+		dl.conn.SetWriteDeadline(time.Now().Add(d))
+		// An explicit timeout wins over extensions made further down.
+		fixed := &deadlines{conn: dl.conn, read: d, max: dl.max}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deadlinesKey, fixed)))
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+type tlsCertificate struct {
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	NotBefore string `json:"not_before"`
+	NotAfter  string `json:"not_after"`
+}
+
+type tlsInfo struct {
+	TLS               bool             `json:"tls"`
+	Version           string           `json:"version,omitempty"`
+	CipherSuite       string           `json:"cipher_suite,omitempty"`
+	ALPN              string           `json:"alpn,omitempty"`
+	ServerName        string           `json:"server_name,omitempty"`
+	Resumed           bool             `json:"resumed,omitempty"`
+	ClientCertificate []tlsCertificate `json:"client_certificates,omitempty"`
+}
+
+// TLSHandler reports what was negotiated for the request's TLS connection:
+// version, cipher suite, ALPN protocol, SNI name and any client certificate
+// chain.
+func TLSHandler(w http.ResponseWriter, r *http.Request) {
+	var info tlsInfo
+	if cs := r.TLS; cs != nil {
+		info = tlsInfo{
+			TLS:         true,
+			Version:     tlsVersions[cs.Version],
+			CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+			ALPN:        cs.NegotiatedProtocol,
+			ServerName:  cs.ServerName,
+			Resumed:     cs.DidResume,
+		}
+		if info.Version == "" {
+			info.Version = fmt.Sprintf("0x%04x", cs.Version)
+		}
+		for _, cert := range cs.PeerCertificates {
+			info.ClientCertificate = append(info.ClientCertificate, tlsCertificate{
+				Subject:   cert.Subject.String(),
+				Issuer:    cert.Issuer.String(),
+				NotBefore: cert.NotBefore.UTC().Format(http.TimeFormat),
+				NotAfter:  cert.NotAfter.UTC().Format(http.TimeFormat),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	json.NewEncoder(w).Encode(info)
+}
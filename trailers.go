@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// forbiddenTrailers are the fields RFC 9110 section 6.5.1 keeps out of
+// trailers: those framing, routing, authenticating or otherwise controlling
+// the message, which recipients must act on before the body.
+var forbiddenTrailers = map[string]bool{
+	"Age":                 true,
+	"Authorization":       true,
+	"Cache-Control":       true,
+	"Connection":          true,
+	"Content-Encoding":    true,
+	"Content-Length":      true,
+	"Content-Range":       true,
+	"Content-Type":        true,
+	"Date":                true,
+	"Expect":              true,
+	"Expires":             true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Location":            true,
+	"Max-Forwards":        true,
+	"Pragma":              true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Range":               true,
+	"Retry-After":         true,
+	"Set-Cookie":          true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Vary":                true,
+	"Www-Authenticate":    true,
+}
+
+// TrailersHandler sends a chunked response that announces and then emits
+// HTTP trailers. Each trailer query parameter is a Name:value pair; without
+// any, an X-Checksum trailer carries the SHA-256 of the body.
+func TrailersHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	trailers := http.Header{}
+	for _, t := range r.URL.Query()["trailer"] {
+		name, value, ok := strings.Cut(t, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) || strings.ContainsAny(value, "\r\n") {
+			badRequest(w, errors.Errorf("Invalid trailer %q, expected Name:value", t))
+			return
+		}
+		if name = http.CanonicalHeaderKey(name); forbiddenTrailers[name] || strings.HasPrefix(name, "If-") {
+			badRequest(w, errors.Errorf("%s is not allowed as a trailer", name))
+			return
+		}
+		trailers.Add(name, strings.TrimSpace(value))
+	}
+	checksum := len(trailers) == 0
+	if checksum {
+		trailers.Set("X-Checksum", "")
+	}
+
+	for name := range trailers {
+		w.Header().Add("Trailer", name)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	flusher, _ := w.(http.Flusher)
+	hash := sha256.New()
+	for i := 0; i < 3; i++ {
+		chunk := fmt.Sprintf("chunk %d: %d %s\n", i, code, http.StatusText(code))
+		fmt.Fprint(w, chunk)
+		hash.Write([]byte(chunk))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if checksum {
+		trailers.Set("X-Checksum", "sha256="+hex.EncodeToString(hash.Sum(nil)))
+	}
+	for name, values := range trailers {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+}
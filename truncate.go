@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	globalParam("abort-after", "content-length", "truncate")
+}
+
+// lingerTime is how long linger holds a connection open.
+const lingerTime = 5 * time.Second
+
+// truncation cuts the response body short while still declaring its full
+// Content-Length, so the connection is closed mid-response. truncate gives
+// the share of the body to send as a percentage such as 50%; abort-after
+// gives it as a size.
+func truncation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		percent, after := -1.0, int64(-1)
+		if v := q.Get("truncate"); v != "" {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			if err != nil || f < 0 || f > 100 {
+				badRequest(w, errors.Errorf("Invalid truncate %q, expected a percentage", v))
+				return
+			}
+			percent = f
+		}
+		if v := q.Get("abort-after"); v != "" {
+			n, err := parseSize(v)
+			if err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process abort-after"))
+				return
+			}
+			after = n
+		}
+		if (percent < 0 && after < 0) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := newBufferedWriter(w)
+		next.ServeHTTP(bw, r)
+
+		body := bw.body.Bytes()
+		n := int64(len(body))
+		if percent >= 0 {
+			n = int64(float64(n) * percent / 100)
+		}
+		if after >= 0 && after < n {
+			n = after
+		}
+		// net/http closes the connection when a handler writes less than the
+		// declared Content-Length.
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(bw.code)
+		w.Write(body[:n])
+	})
+}
+
+// contentLengthMismatch declares a Content-Length that differs from the body
+// actually sent. The content-length query parameter is either an offset such
+// as +100 or -50 from the real length, or an absolute length. net/http won't
+// send such a response, so it is written to the hijacked connection, which
+// is closed afterwards.
+func contentLengthMismatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("content-length")
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// An unescaped + in the query string decodes to a space.
+		if strings.HasPrefix(v, " ") {
+			v = "+" + strings.TrimSpace(v)
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process content-length"))
+			return
+		}
+		relative := strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-")
+
+		bw := newBufferedWriter(w)
+		next.ServeHTTP(bw, r)
+
+		body := bw.body.Bytes()
+		if relative {
+			n += int64(len(body))
+		}
+		if n < 0 {
+			n = 0
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		reason := r.URL.Query().Get("reason")
+		conn, buf, err := hijackResponse(w, bw.code, reason)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrap(err, "Unable to hijack connection"))
+			return
+		}
+		defer conn.Close()
+		if r.Method != http.MethodHead {
+			buf.Write(body)
+		}
+		buf.Flush()
+
+		linger(conn, buf)
+	})
+}
+
+// hijackResponse takes over the connection and writes the status line and
+// header of w to it, followed by any extra header lines verbatim, leaving
+// the body to the caller. An empty reason is replaced by the standard one
+// for code.
+func hijackResponse(w http.ResponseWriter, code int, reason string, extra ...string) (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, buf, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if reason == "" {
+		reason = http.StatusText(code)
+	}
+	header := w.Header().Clone()
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	fmt.Fprintf(buf, "HTTP/1.1 %03d %s\r\n", code, reason)
+	header.Write(buf)
+	for _, line := range extra {
+		buf.WriteString(line + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	return conn, buf, nil
+}
+
+// linger leaves a hijacked connection open for a while so a client that
+// believes the response is complete can reuse it and trip over whatever
+// was sent after it.
+func linger(conn net.Conn, buf *bufio.ReadWriter) {
+	conn.SetDeadline(time.Now().Add(lingerTime))
+	io.Copy(io.Discard, buf)
+}
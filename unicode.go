@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// unicodeSamples exercise the ways byte length, code point count and
+// rendered width disagree.
+var unicodeSamples = []struct {
+	label string
+	text  string
+}{
+	{"latin", "Ça va? Grüße, señor! Ærøskøbing"},
+	{"cjk", "状态码 ステータスコード 상태 코드"},
+	{"combining", "e\u0301 a\u0308 n\u0303 Z̵̡̬͙a̷̗̣ḻ̸g̴̹o̶͓"},
+	{"rtl", "שלום مرحبا \u202eoverride\u202c \u2067isolate\u2069"},
+	{"emoji", "😀 🚀 🏳️‍🌈 👩‍👩‍👧‍👦 👍🏽 🇨🇦"},
+	{"astral", "𝕳𝖙𝖙𝖕 𐍈 𓂀 𝄞"},
+	{"invisible", "zero\u200bwidth\u200cnon\u200djoiner\u00a0nbsp bom\ufeffend"},
+}
+
+// UnicodeHandler writes a UTF-8 body full of multi-byte characters.
+func UnicodeHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := parseCode(r)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+	fmt.Fprintf(w, "%d %s\n", code, http.StatusText(code))
+	for _, s := range unicodeSamples {
+		fmt.Fprintf(w, "%s: %s\n", s.label, s.text)
+	}
+}
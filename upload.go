@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type uploadPart struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	TooLarge    bool   `json:"too_large,omitempty"`
+}
+
+// UploadHandler streams a multipart/form-data upload and reports each part's
+// name, filename, size and SHA-256. Parts larger than the max-size query
+// parameter are flagged, or with reject=true refused with 413. The whole
+// upload may not exceed max.
+func UploadHandler(max int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method %s is not allowed", r.Method))
+			return
+		}
+		partMax := max
+		if v := r.URL.Query().Get("max-size"); v != "" {
+			var err error
+			if partMax, err = parseSize(v); err != nil {
+				badRequest(w, errors.Wrap(err, "Unable to process max-size"))
+				return
+			}
+		}
+		reject, err := boolParam(r, "reject")
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process reject"))
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("Expected a multipart/form-data body"))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process upload"))
+			return
+		}
+		parts := []uploadPart{}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			hash := sha256.New()
+			n, err := io.Copy(hash, p)
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			part := uploadPart{
+				Name:        p.FormName(),
+				Filename:    p.FileName(),
+				ContentType: p.Header.Get("Content-Type"),
+				Size:        n,
+				SHA256:      hex.EncodeToString(hash.Sum(nil)),
+				TooLarge:    n > partMax,
+			}
+			if part.TooLarge && reject {
+				writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("Part %q is %d bytes, more than the %d allowed", part.Name, n, partMax))
+				return
+			}
+			parts = append(parts, part)
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(map[string]interface{}{"parts": parts})
+	}
+}
+
+// uploadError reports a failure reading an upload, as 413 if it was too big.
+func uploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("Upload must not exceed %d bytes", tooLarge.Limit))
+		return
+	}
+	badRequest(w, errors.Wrap(err, "Unable to process upload"))
+}
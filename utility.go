@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRandomString caps the length of /random/string.
+const maxRandomString = 1 << 16
+
+var alphabets = map[string]string{
+	"hex":       "0123456789abcdef",
+	"digits":    "0123456789",
+	"alpha":     "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alnum":     "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"base64url": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+}
+
+// writeValue responds with a single named value, as a JSON object or, if
+// the client prefers it, as a line of plain text.
+func writeValue(w http.ResponseWriter, r *http.Request, name, value string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if accept := r.Header.Values("Accept"); acceptQuality(accept, "text/plain") > acceptQuality(accept, "application/json") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, value)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{name: value})
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// UUIDHandler responds with a random version 4 UUID.
+func UUIDHandler(w http.ResponseWriter, r *http.Request) {
+	writeValue(w, r, "uuid", newUUID())
+}
+
+// NowHandler responds with the current time in the format query parameter:
+// rfc3339 (the default), unix, unix-ms or http-date.
+func NowHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	var value string
+	switch f := r.URL.Query().Get("format"); f {
+	case "", "rfc3339":
+		value = now.Format(time.RFC3339Nano)
+	case "unix":
+		value = strconv.FormatInt(now.Unix(), 10)
+	case "unix-ms":
+		value = strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	case "http-date":
+		value = now.Format(http.TimeFormat)
+	default:
+		badRequest(w, errors.Errorf("Unsupported format %q, expected rfc3339, unix, unix-ms or http-date", f))
+		return
+	}
+	writeValue(w, r, "now", value)
+}
+
+// RandomStringHandler responds with a random string of len characters drawn
+// from alphabet, either one of the named alphabets or the characters to use.
+func RandomStringHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := intParam(r, "len", 32)
+	if err != nil {
+		badRequest(w, errors.Wrap(err, "Unable to process len"))
+		return
+	}
+	if n > maxRandomString {
+		badRequest(w, errors.Errorf("len must not exceed %d", maxRandomString))
+		return
+	}
+	alphabet := r.URL.Query().Get("alphabet")
+	if named, ok := alphabets[alphabet]; ok {
+		alphabet = named
+	} else if alphabet == "" {
+		alphabet = alphabets["alnum"]
+	}
+	chars := []rune(alphabet)
+
+	out := make([]rune, n)
+	max := big.NewInt(int64(len(chars)))
+	for i := range out {
+		j, _ := rand.Int(rand.Reader, max)
+		out[i] = chars[j.Int64()]
+	}
+	writeValue(w, r, "string", string(out))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	globalParam("vary")
+}
+
+// vary adds the request headers listed in the vary query parameter to the
+// Vary response header, and folds their values into the body so that each
+// variant really differs: as a "vary" member of JSON objects, as trailing
+// lines of plain text, or as a list at the end of HTML. The vary query
+// parameter accepts a comma-separated list.
+func vary(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, name := range strings.Split(r.URL.Query().Get("vary"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+		if len(names) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, name := range names {
+			w.Header().Add("Vary", name)
+		}
+		bw := newBufferedWriter(w)
+		next.ServeHTTP(bw, r)
+		bw.send(varyBody(w.Header().Get("Content-Type"), bw.body.Bytes(), names, r.Header))
+	})
+}
+
+func varyBody(contentType string, body []byte, names []string, header http.Header) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) < 2 || trimmed[0] != '{' {
+			return body
+		}
+		values := map[string]string{}
+		for _, name := range names {
+			values[name] = header.Get(name)
+		}
+		member, _ := json.Marshal(values)
+		out := append([]byte{}, trimmed[:len(trimmed)-1]...)
+		if len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, `"vary":`...)
+		out = append(out, member...)
+		return append(out, '}')
+	case mediaType == "text/html":
+		var list strings.Builder
+		list.WriteString("<ul class=\"vary\">")
+		for _, name := range names {
+			fmt.Fprintf(&list, "<li>%s: %s</li>", html.EscapeString(name), html.EscapeString(header.Get(name)))
+		}
+		list.WriteString("</ul>\n")
+		if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+			return append(append(append([]byte{}, body[:i]...), list.String()...), body[i:]...)
+		}
+		return append(body, list.String()...)
+	case strings.HasPrefix(mediaType, "text/"):
+		var out bytes.Buffer
+		out.Write(body)
+		if out.Len() > 0 && !bytes.HasSuffix(body, []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		for _, name := range names {
+			fmt.Fprintf(&out, "%s: %s\n", name, header.Get(name))
+		}
+		return out.Bytes()
+	default:
+		return body
+	}
+}
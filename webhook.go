@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxWebhookRetries caps the retries query parameter, and maxPendingWebhooks
+// how many deliveries may be waiting or in flight at once.
+const (
+	maxWebhookRetries  = 10
+	maxPendingWebhooks = 100
+)
+
+// webhookClient does not follow redirects, which could lead anywhere.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// webhookHosts are the hosts webhooks may be delivered to. An entry of the
+// form *.example.com also allows every subdomain of example.com.
+type webhookHosts []string
+
+// parseWebhookHosts parses a comma separated list of host names.
+func parseWebhookHosts(v string) webhookHosts {
+	var hosts webhookHosts
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			hosts = append(hosts, entry)
+		}
+	}
+	return hosts
+}
+
+func (h webhookHosts) allows(host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range h {
+		if entry == host || (strings.HasPrefix(entry, "*.") && strings.HasSuffix(host, entry[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+type webhook struct {
+	id          string
+	url         string
+	payload     []byte
+	contentType string
+	delay       time.Duration
+	retries     int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+// deliver POSTs the payload, retrying transport errors and non-2xx responses
+// with exponential backoff, and logs how it went.
+func (wh webhook) deliver(logger *log.Logger) {
+	time.Sleep(wh.delay)
+	backoff := wh.backoff
+	for attempt := 1; ; attempt++ {
+		err := wh.post(attempt)
+		if err == nil {
+			logger.Println("webhook", wh.id, "delivered to", wh.url, "on attempt", attempt)
+			return
+		}
+		if attempt > wh.retries {
+			logger.Println("webhook", wh.id, "gave up on", wh.url, "after", attempt, "attempts:", err)
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > wh.maxBackoff {
+			backoff = wh.maxBackoff
+		}
+	}
+}
+
+func (wh webhook) post(attempt int) error {
+	req, err := http.NewRequest(http.MethodPost, wh.url, bytes.NewReader(wh.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", wh.contentType)
+	req.Header.Set("User-Agent", "httpcodes-webhook")
+	req.Header.Set("X-Webhook-Id", wh.id)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxBodySize))
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("Receiver responded %d", res.StatusCode)
+	}
+	return nil
+}
+
+// WebhookHandler accepts a callback with 202 and POSTs it to the url query
+// parameter in the background after webhook-delay, retrying up to retries
+// times with backoff doubling from its starting value. The payload is the
+// request body, or else a JSON event reporting the code query parameter.
+// Delays and backoff may not exceed max. Webhooks are only delivered to the
+// allowed hosts, and not at all without any.
+func WebhookHandler(max time.Duration, allowed webhookHosts, logger *log.Logger) http.HandlerFunc {
+	pending := make(chan struct{}, maxPendingWebhooks)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(allowed) == 0 {
+			writeError(w, http.StatusForbidden, errors.New("Webhooks are disabled, set WEBHOOK_ALLOWED_HOSTS to enable them"))
+			return
+		}
+		target := r.URL.Query().Get("url")
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			badRequest(w, errors.Errorf("Invalid url %q, expected an absolute http or https URL", target))
+			return
+		}
+		if !allowed.allows(u.Hostname()) {
+			writeError(w, http.StatusForbidden, errors.Errorf("Host %q is not in WEBHOOK_ALLOWED_HOSTS", u.Hostname()))
+			return
+		}
+		code := http.StatusOK
+		if v := r.URL.Query().Get("code"); v != "" {
+			if code, err = checkCode(r, v); err != nil {
+				badRequest(w, err)
+				return
+			}
+		}
+		wh := webhook{id: newUUID(), url: target, maxBackoff: max}
+		if wh.delay, err = durationParam(r, "webhook-delay", 0); err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process webhook-delay"))
+			return
+		}
+		if wh.backoff, err = durationParam(r, "backoff", time.Second); err != nil {
+			badRequest(w, errors.Wrap(err, "Unable to process backoff"))
+			return
+		}
+		if wh.delay > max || wh.backoff > max {
+			badRequest(w, errors.Errorf("Webhook delay and backoff must not exceed %s", max))
+			return
+		}
+		if v := r.URL.Query().Get("retries"); v != "" {
+			if wh.retries, err = strconv.Atoi(v); err != nil || wh.retries < 0 || wh.retries > maxWebhookRetries {
+				badRequest(w, errors.Errorf("Invalid retries %q, expected 0 to %d", v, maxWebhookRetries))
+				return
+			}
+		}
+
+		if wh.payload, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize)); err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, errors.Wrap(err, "Unable to read body"))
+			return
+		}
+		wh.contentType = r.Header.Get("Content-Type")
+		if len(wh.payload) == 0 {
+			wh.payload, _ = json.Marshal(map[string]interface{}{
+				"id":      wh.id,
+				"event":   "httpcodes.webhook",
+				"code":    code,
+				"status":  http.StatusText(code),
+				"created": time.Now().UTC(),
+			})
+			wh.contentType = "application/json"
+		} else if wh.contentType == "" {
+			wh.contentType = "application/octet-stream"
+		}
+
+		select {
+		case pending <- struct{}{}:
+		default:
+			writeError(w, http.StatusServiceUnavailable, errors.Errorf("Too many pending webhooks, at most %d at once", maxPendingWebhooks))
+			return
+		}
+		go func() {
+			defer func() { <-pending }()
+			wh.deliver(logger)
+		}()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      wh.id,
+			"url":     wh.url,
+			"delay":   wh.delay.String(),
+			"retries": wh.retries,
+		})
+	}
+}